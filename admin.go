@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdminToken guards the /admin routes and /metrics with the
+// ADMIN_TOKEN bearer token. Without ADMIN_TOKEN the routes are disabled.
+func requireAdminToken(c *gin.Context) {
+	token := cfg.Admin.Token
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: "Route not found"})
+		return
+	}
+
+	given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	c.Next()
+}
+
+func handleGeocoderStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, geo.Status())
+}
+
+func handleGeocoderReload(c *gin.Context) {
+	if err := geo.Reload(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error reloading geocoding data", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload geocoding data", "status": geo.Status()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Geocoding data reloaded")
+	c.JSON(http.StatusOK, geo.Status())
+}
+
+func reloadGeocoderOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		slog.Info("SIGHUP received, reloading geocoding data")
+		if err := geo.Reload(); err != nil {
+			slog.Error("Error reloading geocoding data", "error", err)
+			continue
+		}
+		slog.Info("Geocoding data reloaded")
+	}
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/google/uuid"
+	"github.com/mmcloughlin/geohash"
+
+	"meshcore-map-api/internal/bandplan"
+	"meshcore-map-api/internal/lora"
+)
+
+var backfillTables = []string{"repeater_reports", "dead_zones"}
+
+// backfillMaps names the lookup tables of one backfill run. The run ID keeps
+// concurrent backfills from filling and dropping each other's tables.
+type backfillMaps struct {
+	geocode string
+	radio   string
+}
+
+func newBackfillMaps() backfillMaps {
+	run := strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+	return backfillMaps{
+		geocode: "backfill_geocode_" + run,
+		radio:   "backfill_radio_" + run,
+	}
+}
+
+// aggregateRebuild refills an aggregate of a backfilled table, which groups
+// by columns the backfill rewrites, from the rewritten rows.
+type aggregateRebuild struct {
+	table string
+	// since selects the aggregated rows from a time on.
+	since string
+	// insert aggregates the raw rows matching a %s condition.
+	insert string
+}
+
+var backfillAggregates = map[string][]aggregateRebuild{
+	"repeater_reports": {
+		{
+			table: "repeater_reports_hourly",
+			since: "hour >= ?",
+			insert: `
+				INSERT INTO repeater_reports_hourly
+				SELECT
+					toStartOfHour(timestamp) AS hour,
+					repeater_pubkey,
+					repeater_name,
+					device_id,
+					device_name,
+					geohash,
+					region_code,
+					district_code,
+					country_code,
+					count() AS report_count,
+					avg(rssi) AS avg_rssi,
+					avg(snr) AS avg_snr,
+					min(rssi) AS min_rssi,
+					max(rssi) AS max_rssi
+				FROM repeater_reports
+				WHERE %s
+				GROUP BY hour, repeater_pubkey, repeater_name, device_id, device_name,
+					geohash, region_code, district_code, country_code`,
+		},
+		{
+			table: "repeater_reports_daily",
+			since: "day >= toDate(?)",
+			insert: `
+				INSERT INTO repeater_reports_daily (
+					day, repeater_pubkey, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx,
+					reporter_pubkey, repeater_name, region_code, district_code, country_code, locality_id,
+					reports, rssi_sum, rssi_min, rssi_max, snr_sum, reporters, last_seen
+				)
+				SELECT
+					toDate(timestamp) AS day,
+					repeater_pubkey,
+					geohash,
+					radio_preset,
+					radio_freq,
+					radio_bw,
+					radio_sf,
+					radio_cr,
+					radio_tx,
+					reporter_pubkey,
+					anyLast(repeater_name),
+					anyLast(toString(region_code)),
+					anyLast(toString(district_code)),
+					anyLast(toString(country_code)),
+					anyLast(locality_id),
+					count(),
+					sum(toInt64(rssi)),
+					min(rssi),
+					max(rssi),
+					sum(toFloat64(snr)),
+					uniqState(toString(reporter_pubkey)),
+					max(timestamp)
+				FROM repeater_reports
+				WHERE %s
+				GROUP BY day, repeater_pubkey, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, reporter_pubkey`,
+		},
+	},
+	"dead_zones": {
+		{
+			table: "dead_zones_daily",
+			since: "day >= toDate(?)",
+			insert: `
+				INSERT INTO dead_zones_daily (
+					day, geohash, radio_preset, reporter_pubkey,
+					region_code, district_code, country_code, locality_id,
+					scans, reporters, last_seen
+				)
+				SELECT
+					toDate(timestamp) AS day,
+					geohash,
+					radio_preset,
+					reporter_pubkey,
+					anyLast(toString(region_code)),
+					anyLast(toString(district_code)),
+					anyLast(toString(country_code)),
+					anyLast(locality_id),
+					count(),
+					uniqState(toString(reporter_pubkey)),
+					max(timestamp)
+				FROM dead_zones
+				WHERE %s
+				GROUP BY day, geohash, radio_preset, reporter_pubkey`,
+		},
+	},
+}
+
+// backfillState records the partitions already rewritten, per table, so an
+// interrupted backfill resumes where it stopped.
+type backfillState struct {
+	path string
+	Done map[string][]string `json:"done"`
+}
+
+func loadBackfillState(path string) (*backfillState, error) {
+	state := &backfillState{path: path, Done: make(map[string][]string)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if state.Done == nil {
+		state.Done = make(map[string][]string)
+	}
+	return state, nil
+}
+
+func (s *backfillState) isDone(table, partition string) bool {
+	return slices.Contains(s.Done[table], partition)
+}
+
+func (s *backfillState) markDone(table, partition string) error {
+	s.Done[table] = append(s.Done[table], partition)
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// runBackfill re-geocodes stored reports and dead zones month by month,
+// rewrites their location, compliance and preset columns with mutations and
+// rebuilds the aggregates grouping by them.
+func runBackfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	statePath := flags.String("state", filepath.Join("data", "backfill-state.json"), "file recording finished partitions")
+	tables := flags.String("tables", strings.Join(backfillTables, ","), "comma-separated tables to backfill")
+	from := flags.String("from", "", "first partition to backfill (YYYYMM)")
+	to := flags.String("to", "", "last partition to backfill (YYYYMM)")
+	restart := flags.Bool("restart", false, "ignore the progress in -state and start over")
+	flags.Parse(args)
+
+	if !geo.Ready() {
+		return errors.New("geocoding data not loaded")
+	}
+	// Each replica runs the mutations itself, reading the lookup tables,
+	// which only exist on the server they were filled on.
+	if cfg.ClickHouse.Cluster != "" {
+		return errors.New("backfill is not supported on a cluster")
+	}
+
+	for _, table := range strings.Split(*tables, ",") {
+		if !slices.Contains(backfillTables, table) {
+			return fmt.Errorf("unknown table %q", table)
+		}
+	}
+
+	state, err := loadBackfillState(*statePath)
+	if err != nil {
+		return err
+	}
+	if *restart {
+		state.Done = make(map[string][]string)
+	}
+
+	ctx := context.Background()
+
+	maps := newBackfillMaps()
+	if err := maps.create(ctx); err != nil {
+		return err
+	}
+	defer maps.drop(ctx)
+
+	for _, table := range strings.Split(*tables, ",") {
+		partitions, err := getPartitions(ctx, table)
+		if err != nil {
+			return err
+		}
+
+		var pending []string
+		for _, p := range partitions {
+			if (*from != "" && p < *from) || (*to != "" && p > *to) || state.isDone(table, p) {
+				continue
+			}
+			pending = append(pending, p)
+		}
+
+		slog.Info("Backfilling", "table", table, "pending", len(pending), "partitions", len(partitions))
+
+		for i, partition := range pending {
+			start := time.Now()
+
+			cells, configurations, err := maps.backfillPartition(ctx, table, partition)
+			if err != nil {
+				return fmt.Errorf("%s partition %s: %w", table, partition, err)
+			}
+			if err := rebuildAggregates(ctx, table, partition); err != nil {
+				return fmt.Errorf("%s partition %s: %w", table, partition, err)
+			}
+			if err := state.markDone(table, partition); err != nil {
+				return fmt.Errorf("failed to save backfill state: %w", err)
+			}
+
+			slog.Info("Backfilled partition",
+				"table", table,
+				"partition", partition,
+				"progress", fmt.Sprintf("%d/%d", i+1, len(pending)),
+				"cells", cells,
+				"configurations", configurations,
+				"duration_ms", time.Since(start).Milliseconds())
+		}
+	}
+
+	slog.Info("Backfill complete")
+	return nil
+}
+
+func (m backfillMaps) create(ctx context.Context) error {
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			geohash String,
+			region_code FixedString(3),
+			district_code FixedString(3),
+			country_code FixedString(2),
+			subdivision_code String,
+			locality_id UInt32
+		) ENGINE = Join(ANY, LEFT, geohash)`, m.geocode),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			country_code FixedString(2),
+			radio_freq Float32,
+			radio_bw Float32,
+			radio_sf UInt8,
+			radio_cr UInt8,
+			radio_tx UInt8,
+			band_plan String,
+			compliance_status String,
+			radio_preset String
+		) ENGINE = Join(ANY, LEFT, country_code, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx)`, m.radio),
+	}
+
+	for _, stmt := range statements {
+		if err := db.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create backfill tables: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m backfillMaps) drop(ctx context.Context) {
+	for _, table := range []string{m.geocode, m.radio} {
+		if err := db.Exec(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+			slog.Error("Error dropping backfill table", "table", table, "error", err)
+		}
+	}
+}
+
+func getPartitions(ctx context.Context, table string) ([]string, error) {
+	rows, err := db.Query(ctx, `
+		SELECT DISTINCT partition_id
+		FROM system.parts
+		WHERE database = currentDatabase() AND table = ? AND active
+		ORDER BY partition_id
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var partitions []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("failed to scan partition: %w", err)
+		}
+		partitions = append(partitions, p)
+	}
+
+	return partitions, rows.Err()
+}
+
+// mutationContext lets the mutations use joinGet and waits for them to
+// finish on every replica, without the server's query time limit.
+func mutationContext(ctx context.Context) context.Context {
+	return clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"allow_nondeterministic_mutations": 1,
+		"mutations_sync":                   2,
+		"max_execution_time":               0,
+	}))
+}
+
+// backfillPartition geocodes each geohash cell in the partition once, from
+// the mean precise position of its rows or the cell centre when only the
+// geohash was stored, then rewrites the location columns from that map.
+// Compliance depends on the country, so it is rechecked afterwards, along with
+// the preset of rows stored before radio_preset was added.
+func (m backfillMaps) backfillPartition(ctx context.Context, table, partition string) (int, int, error) {
+	month, err := strconv.ParseUint(partition, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected partition id %q", partition)
+	}
+
+	cells, err := m.fillGeocodeMap(ctx, table, uint32(month))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = db.Exec(mutationContext(ctx), fmt.Sprintf(`
+		ALTER TABLE %[1]s UPDATE
+			region_code = ifNull(joinGetOrNull('%[2]s', 'region_code', geohash), region_code),
+			district_code = ifNull(joinGetOrNull('%[2]s', 'district_code', geohash), district_code),
+			country_code = ifNull(joinGetOrNull('%[2]s', 'country_code', geohash), country_code),
+			subdivision_code = ifNull(joinGetOrNull('%[2]s', 'subdivision_code', geohash), subdivision_code),
+			locality_id = ifNull(joinGetOrNull('%[2]s', 'locality_id', geohash), locality_id)
+		IN PARTITION ID ?
+		WHERE geohash != ''
+	`, table, m.geocode), partition)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrite location columns: %w", err)
+	}
+
+	configurations, err := m.fillRadioMap(ctx, table, uint32(month))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = db.Exec(mutationContext(ctx), fmt.Sprintf(`
+		ALTER TABLE %[1]s UPDATE
+			band_plan = ifNull(joinGetOrNull('%[2]s', 'band_plan', %[3]s), band_plan),
+			compliance_status = ifNull(joinGetOrNull('%[2]s', 'compliance_status', %[3]s), compliance_status),
+			radio_preset = ifNull(joinGetOrNull('%[2]s', 'radio_preset', %[3]s), radio_preset)
+		IN PARTITION ID ?
+		WHERE 1
+	`, table, m.radio, radioMapKey), partition)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrite compliance and preset columns: %w", err)
+	}
+
+	return cells, configurations, nil
+}
+
+func (m backfillMaps) fillGeocodeMap(ctx context.Context, table string, month uint32) (int, error) {
+	if err := db.Exec(ctx, "TRUNCATE TABLE "+m.geocode); err != nil {
+		return 0, fmt.Errorf("failed to clear geocode map: %w", err)
+	}
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT geohash, avg(latitude), avg(longitude)
+		FROM %s
+		WHERE toYYYYMM(timestamp) = ? AND geohash != ''
+		GROUP BY geohash
+	`, table), month)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query geohash cells: %w", err)
+	}
+	defer rows.Close()
+
+	batch, err := db.PrepareBatch(ctx, "INSERT INTO "+m.geocode)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare geocode map: %w", err)
+	}
+
+	cells := 0
+	for rows.Next() {
+		var hash string
+		var lat, lon *float64
+		if err := rows.Scan(&hash, &lat, &lon); err != nil {
+			return 0, fmt.Errorf("failed to scan geohash cell: %w", err)
+		}
+
+		var pLat, pLon float64
+		if lat != nil && lon != nil {
+			pLat, pLon = *lat, *lon
+		} else {
+			pLat, pLon = geohash.DecodeCenter(hash)
+		}
+
+		location := geo.Locate(pLat, pLon)
+		if err := batch.Append(
+			hash,
+			location.RegionCode,
+			location.DistrictCode,
+			location.CountryCode,
+			location.SubdivisionCode,
+			location.LocalityID,
+		); err != nil {
+			return 0, fmt.Errorf("failed to append geocode map row: %w", err)
+		}
+		cells++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := batch.Send(); err != nil {
+		return 0, fmt.Errorf("failed to fill geocode map: %w", err)
+	}
+	return cells, nil
+}
+
+// radioMapKey is the key of the radio map, as columns of the backfilled table.
+const radioMapKey = "CAST(country_code AS FixedString(2)), radio_freq, radio_bw, radio_sf, radio_cr, radio_tx"
+
+func (m backfillMaps) fillRadioMap(ctx context.Context, table string, month uint32) (int, error) {
+	if err := db.Exec(ctx, "TRUNCATE TABLE "+m.radio); err != nil {
+		return 0, fmt.Errorf("failed to clear radio map: %w", err)
+	}
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT DISTINCT %s
+		FROM %s
+		WHERE toYYYYMM(timestamp) = ?
+	`, radioMapKey, table), month)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query radio configurations: %w", err)
+	}
+	defer rows.Close()
+
+	batch, err := db.PrepareBatch(ctx, "INSERT INTO "+m.radio)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare radio map: %w", err)
+	}
+
+	configurations := 0
+	for rows.Next() {
+		var country string
+		var freq, bw float32
+		var sf, cr, tx uint8
+		if err := rows.Scan(&country, &freq, &bw, &sf, &cr, &tx); err != nil {
+			return 0, fmt.Errorf("failed to scan radio configuration: %w", err)
+		}
+
+		// Float32 columns round-trip with noise; channels are set in kHz.
+		freqMHz := math.Round(float64(freq)*1000) / 1000
+		compliance := bandplan.Check(strings.TrimRight(country, "\x00"), freqMHz, float64(bw), int(tx))
+		preset := lora.Classify(freqMHz, float64(bw), int(sf), int(cr))
+		if err := batch.Append(country, freq, bw, sf, cr, tx, compliance.Plan, compliance.Status, preset); err != nil {
+			return 0, fmt.Errorf("failed to append radio map row: %w", err)
+		}
+		configurations++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := batch.Send(); err != nil {
+		return 0, fmt.Errorf("failed to fill radio map: %w", err)
+	}
+	return configurations, nil
+}
+
+// rebuildAggregates replaces the aggregates of a rewritten partition with
+// ones computed from its rows, from the retention cutoff on: older days are
+// no longer stored raw, so their aggregates are kept as they are.
+func rebuildAggregates(ctx context.Context, table, partition string) error {
+	since, ok := rebuildSince(partition, rawDataCutoff(time.Now()))
+	if !ok {
+		slog.Info("Keeping aggregates of expired partition", "table", table, "partition", partition)
+		return nil
+	}
+	month, err := strconv.ParseUint(partition, 10, 32)
+	if err != nil {
+		return fmt.Errorf("unexpected partition id %q", partition)
+	}
+
+	for _, aggregate := range backfillAggregates[table] {
+		// The aggregate is cleared at the start of a second and refilled from
+		// the rows ingested before it; rows ingested from then on reach it
+		// through its view. ingested_at has second resolution, so clearing
+		// mid-second would drop the rows of that second already aggregated.
+		ingestedBefore := time.Now().UTC().Truncate(time.Second).Add(time.Second)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(ingestedBefore)):
+		}
+		err := db.Exec(mutationContext(ctx),
+			fmt.Sprintf("ALTER TABLE %s DELETE IN PARTITION ID ? WHERE %s", aggregate.table, aggregate.since),
+			partition, since)
+		if err != nil {
+			return fmt.Errorf("failed to clear %s: %w", aggregate.table, err)
+		}
+
+		err = db.Exec(mutationContext(ctx), fmt.Sprintf(aggregate.insert, "toYYYYMM(timestamp) = ? AND timestamp >= ? AND ingested_at < ?"),
+			uint32(month), since, ingestedBefore)
+		if err != nil {
+			return fmt.Errorf("failed to rebuild %s: %w", aggregate.table, err)
+		}
+	}
+	return nil
+}
+
+// rebuildSince is where the aggregates of a monthly partition are rebuilt
+// from: its start, or the retention cutoff within it. It is false when the
+// whole month is before the cutoff.
+func rebuildSince(partition string, cutoff time.Time) (time.Time, bool) {
+	start, err := time.Parse("200601", partition)
+	if err != nil || !start.AddDate(0, 1, 0).After(cutoff) {
+		return time.Time{}, false
+	}
+	if cutoff.After(start) {
+		return cutoff, true
+	}
+	return start, true
+}
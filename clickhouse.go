@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"meshcore-map-api/internal/config"
+)
+
+var (
+	connOpenStrategies = map[string]clickhouse.ConnOpenStrategy{
+		"in_order":    clickhouse.ConnOpenInOrder,
+		"round_robin": clickhouse.ConnOpenRoundRobin,
+		"random":      clickhouse.ConnOpenRandom,
+	}
+	compressionMethods = map[string]clickhouse.CompressionMethod{
+		"lz4":  clickhouse.CompressionLZ4,
+		"zstd": clickhouse.CompressionZSTD,
+	}
+)
+
+func initClickHouse() (driver.Conn, error) {
+	options, err := clickHouseOptions(cfg.ClickHouse)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Ping(context.Background()); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Successfully connected to ClickHouse", "protocol", options.Protocol.String(), "addr", options.Addr)
+	return conn, nil
+}
+
+// clickHouseOptions builds the driver options from the DSN, if set, or the
+// individual settings.
+func clickHouseOptions(c config.ClickHouse) (*clickhouse.Options, error) {
+	var options *clickhouse.Options
+	if c.DSN != "" {
+		var err error
+		if options, err = clickhouse.ParseDSN(c.DSN); err != nil {
+			return nil, fmt.Errorf("invalid ClickHouse DSN: %w", err)
+		}
+		// Certificate files can't be given in the DSN.
+		if c.TLS.Enabled {
+			if options.TLS, err = tlsConfig(c.TLS); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		options = &clickhouse.Options{
+			Auth: clickhouse.Auth{
+				Database: c.Database,
+				Username: c.User,
+				Password: c.Password,
+			},
+			ConnOpenStrategy: connOpenStrategies[c.ConnOpenStrategy],
+		}
+		if c.Protocol == "http" {
+			options.Protocol = clickhouse.HTTP
+		}
+		if c.TLS.Enabled {
+			var err error
+			if options.TLS, err = tlsConfig(c.TLS); err != nil {
+				return nil, err
+			}
+		}
+		if method, ok := compressionMethods[c.Compression]; ok {
+			options.Compression = &clickhouse.Compression{Method: method}
+		}
+
+		port := c.Port
+		if port == 0 {
+			port = defaultClickHousePort(options.Protocol, options.TLS != nil)
+		}
+		hosts := c.Hosts
+		if len(hosts) == 0 {
+			hosts = []string{c.Host}
+		}
+		for _, host := range hosts {
+			if _, _, err := net.SplitHostPort(host); err != nil {
+				host = net.JoinHostPort(host, strconv.Itoa(port))
+			}
+			options.Addr = append(options.Addr, host)
+		}
+	}
+
+	if options.Settings == nil {
+		options.Settings = clickhouse.Settings{}
+	}
+	if _, ok := options.Settings["max_execution_time"]; !ok {
+		options.Settings["max_execution_time"] = int(time.Duration(c.MaxExecutionTime).Seconds())
+	}
+	if options.DialTimeout == 0 {
+		options.DialTimeout = time.Duration(c.DialTimeout)
+	}
+	if options.MaxOpenConns == 0 {
+		options.MaxOpenConns = c.MaxOpenConns
+	}
+	if options.MaxIdleConns == 0 {
+		options.MaxIdleConns = c.MaxIdleConns
+	}
+	if options.ConnMaxLifetime == 0 {
+		options.ConnMaxLifetime = time.Duration(c.ConnMaxLifetime)
+	}
+	return options, nil
+}
+
+func defaultClickHousePort(protocol clickhouse.Protocol, secure bool) int {
+	switch {
+	case protocol == clickhouse.HTTP && secure:
+		return 8443
+	case protocol == clickhouse.HTTP:
+		return 8123
+	case secure:
+		return 9440
+	default:
+		return 9000
+	}
+}
+
+func tlsConfig(c config.TLS) (*tls.Config, error) {
+	conf := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the ClickHouse CA: %w", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in the ClickHouse CA file")
+		}
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the ClickHouse client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
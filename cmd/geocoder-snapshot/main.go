@@ -0,0 +1,50 @@
+// Command geocoder-snapshot compiles the GeoNames city dumps and name files
+// into a compact binary snapshot the geocoder loads at startup.
+//
+//	go run ./cmd/geocoder-snapshot -data data -cities cities15000.zip -o data/geocoder.snap
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"meshcore-map-api/internal/geocoder"
+)
+
+func main() {
+	dataDir := flag.String("data", "data", "directory the GeoNames files are read from")
+	cities := flag.String("cities", geocoder.DefaultCitiesFile, "comma-separated city files, .txt or .zip, supplemental files last")
+	out := flag.String("o", filepath.Join("data", geocoder.DefaultSnapshotFile), "snapshot file to write")
+	flag.Parse()
+
+	opts := geocoder.Options{DataDir: *dataDir}
+	for _, name := range strings.Split(*cities, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Cities = append(opts.Cities, name)
+		}
+	}
+
+	// Write next to the target and rename, so a running server reloading on
+	// SIGHUP never sees a partial file.
+	tmp, err := os.CreateTemp(filepath.Dir(*out), filepath.Base(*out)+".*")
+	if err != nil {
+		log.Fatalf("Failed to create snapshot: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	count, err := geocoder.BuildSnapshot(opts, tmp)
+	if err != nil {
+		log.Fatalf("Failed to build snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		log.Fatalf("Failed to write snapshot: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), *out); err != nil {
+		log.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	log.Printf("Wrote %d cities to %s", count, *out)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+
+	"meshcore-map-api/internal/bandplan"
+	"meshcore-map-api/internal/lora"
+)
+
+const (
+	defaultComplianceLimit = 100
+	maxPacketBytes         = 255
+)
+
+var nonCompliantStatuses = []string{bandplan.StatusOutOfBand, bandplan.StatusOverPower}
+
+type ComplianceListQuery struct {
+	Status string `form:"status" validate:"omitempty,oneof=compliant out_of_band over_power unknown_country"`
+	Preset string `form:"preset" validate:"omitempty,radio_preset"`
+	Limit  int    `form:"limit" validate:"omitempty,min=1,max=1000"`
+}
+
+type RadioConfiguration struct {
+	CountryCode       string          `json:"countryCode"`
+	Preset            string          `json:"preset"`
+	Radio             RadioInfo       `json:"radio"`
+	Reports           uint64          `json:"reports"`
+	LastSeen          time.Time       `json:"lastSeen"`
+	Compliance        bandplan.Result `json:"compliance"`
+	MaxPacketsPerHour *float64        `json:"maxPacketsPerHour,omitempty"`
+}
+
+type ComplianceSummary struct {
+	Pubkey         string               `json:"pubkey"`
+	Status         string               `json:"status"`
+	Configurations []RadioConfiguration `json:"configurations"`
+}
+
+type NonCompliantNode struct {
+	Pubkey   string    `json:"pubkey"`
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	Reports  uint64    `json:"reports"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+func handleCompliance(c *gin.Context) {
+	pubkey := c.Param("pubkey")
+	if err := validate.Var(pubkey, "len=64,hexadecimal"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid public key"})
+		return
+	}
+
+	configurations, err := getRadioConfigurations(pubkey)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading radio configurations", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load compliance data"})
+		return
+	}
+	if len(configurations) == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No reports from this node"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summarizeCompliance(pubkey, configurations))
+}
+
+// handleRepeaterCompliance summarises the channels a repeater was heard on.
+// Reports carry the reporter's TX power, not the repeater's, so only the
+// channel is checked against the band plan and channels inside it are
+// power_unknown.
+func handleRepeaterCompliance(c *gin.Context) {
+	pubkey := c.Param("pubkey")
+	if err := validate.Var(pubkey, "len=64,hexadecimal"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid repeater public key"})
+		return
+	}
+
+	configurations, err := getRepeaterChannels(pubkey)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading repeater channels", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load compliance data"})
+		return
+	}
+	if len(configurations) == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No reports of this repeater"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summarizeCompliance(pubkey, configurations))
+}
+
+// summarizeCompliance gives a node the status of its worst configuration.
+func summarizeCompliance(pubkey string, configurations []RadioConfiguration) ComplianceSummary {
+	summary := ComplianceSummary{Pubkey: pubkey, Status: bandplan.StatusCompliant, Configurations: configurations}
+	for _, cfg := range configurations {
+		if bandplan.Severity(cfg.Compliance.Status) > bandplan.Severity(summary.Status) {
+			summary.Status = cfg.Compliance.Status
+		}
+	}
+	return summary
+}
+
+func handleComplianceList(c *gin.Context) {
+	var query ComplianceListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	statuses := nonCompliantStatuses
+	if query.Status != "" {
+		statuses = []string{query.Status}
+	}
+
+	nodes, err := getNodesByCompliance(statuses, query.Preset, intValueOr(query.Limit, defaultComplianceLimit))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading compliance list", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load compliance data"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"nodes": nodes})
+}
+
+// Radio settings in reports and dead zones belong to the reporting node, TX
+// power included, so its full compliance is summarised per reporter_pubkey.
+func getRadioConfigurations(pubkey string) ([]RadioConfiguration, error) {
+	ctx := context.Background()
+
+	rows, err := db.Query(ctx, `
+		SELECT
+			country_code,
+			radio_preset,
+			radio_freq,
+			radio_bw,
+			radio_sf,
+			radio_cr,
+			radio_tx,
+			count() AS reports,
+			max(timestamp) AS last_seen
+		FROM (
+			SELECT country_code, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, timestamp
+			FROM repeater_reports
+			WHERE reporter_pubkey = ?
+			UNION ALL
+			SELECT country_code, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, timestamp
+			FROM dead_zones
+			WHERE reporter_pubkey = ?
+		)
+		GROUP BY country_code, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx
+		ORDER BY last_seen DESC
+	`, pubkey, pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query radio configurations: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRadioConfigurations(rows, true)
+}
+
+// getRepeaterChannels lists the radio settings a repeater was heard with,
+// per country. A reporter only hears repeaters on its own channel.
+func getRepeaterChannels(pubkey string) ([]RadioConfiguration, error) {
+	ctx := context.Background()
+
+	rows, err := db.Query(ctx, `
+		SELECT
+			country_code,
+			radio_preset,
+			radio_freq,
+			radio_bw,
+			radio_sf,
+			radio_cr,
+			count() AS reports,
+			max(timestamp) AS last_seen
+		FROM repeater_reports
+		WHERE repeater_pubkey = ?
+		GROUP BY country_code, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr
+		ORDER BY last_seen DESC
+	`, pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query repeater channels: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRadioConfigurations(rows, false)
+}
+
+// scanRadioConfigurations reads configurations with a radio_tx column after
+// radio_cr when withTX is set, and checks only their channel otherwise.
+func scanRadioConfigurations(rows driver.Rows, withTX bool) ([]RadioConfiguration, error) {
+	configurations := make([]RadioConfiguration, 0)
+	for rows.Next() {
+		var cfg RadioConfiguration
+		var freq, bw float32
+		var sf, cr, tx uint8
+		dest := []any{&cfg.CountryCode, &cfg.Preset, &freq, &bw, &sf, &cr}
+		if withTX {
+			dest = append(dest, &tx)
+		}
+		if err := rows.Scan(append(dest, &cfg.Reports, &cfg.LastSeen)...); err != nil {
+			return nil, fmt.Errorf("failed to scan radio configuration: %w", err)
+		}
+
+		cfg.CountryCode = strings.TrimRight(cfg.CountryCode, "\x00")
+		cfg.Radio = RadioInfo{Freq: float64(freq), BW: float64(bw), SF: int(sf), CR: int(cr), TX: int(tx)}
+		if withTX {
+			cfg.Compliance = bandplan.Check(cfg.CountryCode, cfg.Radio.Freq, cfg.Radio.BW, cfg.Radio.TX)
+		} else {
+			cfg.Compliance = bandplan.CheckChannel(cfg.CountryCode, cfg.Radio.Freq, cfg.Radio.BW)
+		}
+		cfg.MaxPacketsPerHour = maxPacketsPerHour(cfg.Radio, cfg.Compliance)
+
+		configurations = append(configurations, cfg)
+	}
+
+	return configurations, rows.Err()
+}
+
+func maxPacketsPerHour(radio RadioInfo, result bandplan.Result) *float64 {
+	if result.SubBand == nil || result.SubBand.DutyCyclePct == 0 {
+		return nil
+	}
+
+	airtime, err := lora.TimeOnAir(maxPacketBytes, lora.AirtimeParams{
+		SF:             radio.SF,
+		BWKHz:          radio.BW,
+		CR:             radio.CR,
+		ExplicitHeader: true,
+		CRC:            true,
+	})
+	if err != nil {
+		return nil
+	}
+
+	packets := result.SubBand.DutyCyclePct / 100 * float64(time.Hour/time.Millisecond) / airtime.TotalMs
+	return &packets
+}
+
+func getNodesByCompliance(statuses []string, preset string, limit int) ([]NonCompliantNode, error) {
+	ctx := context.Background()
+
+	where := "has(?, compliance_status)"
+	args := []any{statuses}
+	if preset != "" {
+		where += " AND radio_preset = ?"
+		args = append(args, preset)
+	}
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT
+			reporter_pubkey,
+			argMax(reporter_name, timestamp),
+			compliance_status,
+			count() AS reports,
+			max(timestamp) AS last_seen
+		FROM (
+			SELECT reporter_pubkey, reporter_name, compliance_status, timestamp
+			FROM repeater_reports
+			WHERE %[1]s
+			UNION ALL
+			SELECT reporter_pubkey, reporter_name, compliance_status, timestamp
+			FROM dead_zones
+			WHERE %[1]s
+		)
+		GROUP BY reporter_pubkey, compliance_status
+		ORDER BY last_seen DESC
+		LIMIT ?
+	`, where), append(append(args, args...), limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query compliance list: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := make([]NonCompliantNode, 0)
+	for rows.Next() {
+		var n NonCompliantNode
+		if err := rows.Scan(&n.Pubkey, &n.Name, &n.Status, &n.Reports, &n.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan compliance row: %w", err)
+		}
+		n.Pubkey = strings.TrimRight(n.Pubkey, "\x00")
+		nodes = append(nodes, n)
+	}
+
+	return nodes, rows.Err()
+}
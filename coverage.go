@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmcloughlin/geohash"
+
+	"meshcore-map-api/internal/coverage"
+	"meshcore-map-api/internal/geodesy"
+	"meshcore-map-api/internal/lora"
+	"meshcore-map-api/internal/propagation"
+)
+
+const (
+	defaultCoverageRadiusKm = 10.0
+	defaultCoverageCellM    = 100.0
+	defaultRxHeightM        = 1.5
+	defaultTxHeightM        = 10.0
+	calibrationSampleLimit  = 5000
+)
+
+type CoverageQuery struct {
+	Model       string   `form:"model" validate:"omitempty,oneof=free_space okumura_hata log_distance"`
+	Preset      string   `form:"preset" validate:"omitempty,radio_preset"`
+	Environment string   `form:"environment" validate:"omitempty,oneof=urban suburban rural"`
+	Format      string   `form:"format" validate:"omitempty,oneof=geojson png"`
+	RadiusKm    *float64 `form:"radius_km" validate:"omitempty,gt=0,max=100"`
+	CellM       *float64 `form:"cell_m" validate:"omitempty,min=25,max=5000"`
+	Freq        *float64 `form:"freq" validate:"omitempty,min=433,max=928"`
+	BW          *float64 `form:"bw" validate:"omitempty,gt=0"`
+	SF          *int     `form:"sf" validate:"omitempty,min=5,max=12"`
+	TX          *int     `form:"tx" validate:"omitempty,gt=0"`
+	TxGain      float64  `form:"tx_gain"`
+	RxGain      float64  `form:"rx_gain"`
+	TxHeight    *float64 `form:"tx_height" validate:"omitempty,gt=0"`
+	RxHeight    *float64 `form:"rx_height" validate:"omitempty,gt=0"`
+}
+
+type repeaterInfo struct {
+	PublicKey     string
+	Name          string
+	Lat           *float64
+	Lon           *float64
+	AntennaHeight *float32
+}
+
+func (r *repeaterInfo) antennaHeightOr(def float64) float64 {
+	if r.AntennaHeight == nil {
+		return def
+	}
+	return float64(*r.AntennaHeight)
+}
+
+func handleCoverage(c *gin.Context) {
+	pubkey := c.Param("pubkey")
+	if err := validate.Var(pubkey, "len=64,hexadecimal"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid repeater public key"})
+		return
+	}
+
+	var query CoverageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	repeater, err := getRepeater(pubkey)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading repeater", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load repeater"})
+		return
+	}
+	if repeater == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Repeater not found"})
+		return
+	}
+	if repeater.Lat == nil || repeater.Lon == nil {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: "Repeater has no known position"})
+		return
+	}
+
+	radio, err := getLatestRadio(pubkey, query.Preset)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading radio parameters", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load radio parameters"})
+		return
+	}
+	radio = applyRadioOverrides(radio, query)
+	if radio == nil {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: "No radio parameters known for repeater, pass freq, bw, sf and tx"})
+		return
+	}
+
+	sensitivity, err := lora.Sensitivity(radio.SF, radio.BW, lora.DefaultNoiseFigure)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	lat, lon := *repeater.Lat, *repeater.Lon
+	metadata := gin.H{
+		"repeater":    gin.H{"publicKey": repeater.PublicKey, "name": repeater.Name, "lat": lat, "lon": lon},
+		"radio":       radio,
+		"sensitivity": sensitivity,
+	}
+
+	if query.TxHeight == nil {
+		txHeight := repeater.antennaHeightOr(defaultTxHeightM)
+		query.TxHeight = &txHeight
+	}
+
+	model, err := buildCoverageModel(query, *radio, pubkey, lat, lon, metadata)
+	if errors.Is(err, propagation.ErrNotEnoughSamples) {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: "Not enough reports to calibrate log-distance model"})
+		return
+	}
+	if errors.Is(err, propagation.ErrNarrowSpan) || errors.Is(err, propagation.ErrNonPhysicalFit) {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: "Cannot calibrate log-distance model: " + err.Error()})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error building propagation model", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build propagation model"})
+		return
+	}
+	metadata["model"] = model.Name()
+
+	grid, err := coverage.Predict(coverage.Params{
+		Lat:            lat,
+		Lon:            lon,
+		RadiusKm:       ptrValueOr(query.RadiusKm, defaultCoverageRadiusKm),
+		CellSizeM:      ptrValueOr(query.CellM, defaultCoverageCellM),
+		TxPowerDBm:     float64(radio.TX),
+		TxGainDBi:      query.TxGain,
+		RxGainDBi:      query.RxGain,
+		SensitivityDBm: sensitivity,
+		Model:          model,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if query.Format == "png" {
+		var buf bytes.Buffer
+		if err := grid.PNG(&buf); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error rendering coverage PNG", "error", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to render coverage"})
+			return
+		}
+		c.Header("X-Coverage-Bounds", fmt.Sprintf("%f,%f,%f,%f", grid.MinLon, grid.MinLat, grid.MaxLon, grid.MaxLat))
+		c.Data(http.StatusOK, "image/png", buf.Bytes())
+		return
+	}
+
+	fc := grid.GeoJSON()
+	fc.Metadata = metadata
+	c.JSON(http.StatusOK, fc)
+}
+
+func buildCoverageModel(query CoverageQuery, radio RadioInfo, pubkey string, lat, lon float64, metadata gin.H) (propagation.Model, error) {
+	switch query.Model {
+	case propagation.OkumuraHataModel:
+		env, err := propagation.ParseEnvironment(query.Environment)
+		if err != nil {
+			return nil, err
+		}
+		return propagation.OkumuraHata{
+			FreqMHz:     radio.Freq,
+			BaseHeightM: ptrValueOr(query.TxHeight, defaultTxHeightM),
+			MobHeightM:  ptrValueOr(query.RxHeight, defaultRxHeightM),
+			Environment: env,
+		}, nil
+	case propagation.LogDistanceModel:
+		samples, err := getCalibrationSamples(pubkey, query.Preset, lat, lon, float64(radio.TX)+query.TxGain+query.RxGain)
+		if err != nil {
+			return nil, err
+		}
+		fit, err := propagation.FitLogDistance(samples)
+		if err != nil {
+			return nil, err
+		}
+		metadata["calibration"] = gin.H{
+			"samples":   fit.Samples,
+			"exponent":  fit.Model.Exponent,
+			"refLossDb": fit.Model.RefLossDB,
+			"rmseDb":    fit.RMSE,
+		}
+		return fit.Model, nil
+	default:
+		return propagation.FreeSpace{FreqMHz: radio.Freq}, nil
+	}
+}
+
+func applyRadioOverrides(radio *RadioInfo, query CoverageQuery) *RadioInfo {
+	var r RadioInfo
+	if radio != nil {
+		r = *radio
+	}
+	if query.Freq != nil {
+		r.Freq = *query.Freq
+	}
+	if query.BW != nil {
+		r.BW = *query.BW
+	}
+	if query.SF != nil {
+		r.SF = *query.SF
+	}
+	if query.TX != nil {
+		r.TX = *query.TX
+	}
+	if r.Freq == 0 || r.BW == 0 || r.SF == 0 || r.TX == 0 {
+		return nil
+	}
+	return &r
+}
+
+func getRepeater(pubkey string) (*repeaterInfo, error) {
+	ctx := context.Background()
+
+	r := repeaterInfo{PublicKey: pubkey}
+	err := db.QueryRow(ctx, `
+		SELECT
+			argMax(name, updated_at),
+			argMax(lat, updated_at),
+			argMax(lon, updated_at),
+			argMax(antenna_height, updated_at)
+		FROM repeaters
+		WHERE public_key = ?
+		GROUP BY public_key
+	`, pubkey).Scan(&r.Name, &r.Lat, &r.Lon, &r.AntennaHeight)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query repeater: %w", err)
+	}
+
+	return &r, nil
+}
+
+func getLatestRadio(pubkey, preset string) (*RadioInfo, error) {
+	ctx := context.Background()
+
+	where, args := repeaterReportsFilter(pubkey, preset)
+
+	var freq, bw float32
+	var sf, cr, tx uint8
+	// The daily aggregates cover repeaters only heard before the retention.
+	err := db.QueryRow(ctx, fmt.Sprintf(`
+		SELECT radio_freq, radio_bw, radio_sf, radio_cr, radio_tx
+		FROM (
+			(
+				SELECT radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, timestamp AS seen
+				FROM repeater_reports
+				WHERE %[1]s
+				ORDER BY timestamp DESC
+				LIMIT 1
+			)
+			UNION ALL
+			(
+				SELECT radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, last_seen AS seen
+				FROM repeater_reports_daily
+				WHERE %[1]s
+				ORDER BY last_seen DESC
+				LIMIT 1
+			)
+		)
+		ORDER BY seen DESC
+		LIMIT 1
+	`, where), append(args, args...)...).Scan(&freq, &bw, &sf, &cr, &tx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query radio parameters: %w", err)
+	}
+
+	return &RadioInfo{
+		Freq: float64(freq),
+		BW:   float64(bw),
+		SF:   int(sf),
+		CR:   int(cr),
+		TX:   int(tx),
+	}, nil
+}
+
+func getCalibrationSamples(pubkey, preset string, lat, lon, eirp float64) ([]propagation.Sample, error) {
+	ctx := context.Background()
+
+	where, args := repeaterReportsFilter(pubkey, preset)
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT latitude, longitude, geohash, rssi
+		FROM repeater_reports
+		WHERE %s
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, where), append(args, calibrationSampleLimit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reports: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []propagation.Sample
+	for rows.Next() {
+		var pLat, pLon *float64
+		var hash string
+		var rssi int16
+		if err := rows.Scan(&pLat, &pLon, &hash, &rssi); err != nil {
+			return nil, fmt.Errorf("failed to scan report: %w", err)
+		}
+
+		var sLat, sLon float64
+		if pLat != nil && pLon != nil {
+			sLat, sLon = *pLat, *pLon
+		} else if hash != "" {
+			sLat, sLon = geohash.DecodeCenter(hash)
+		} else {
+			continue
+		}
+
+		samples = append(samples, propagation.Sample{
+			DistanceKm: geodesy.Distance(lat, lon, sLat, sLon),
+			PathLossDB: eirp - float64(rssi),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(samples) < calibrationSampleLimit {
+		older, err := getDailyCalibrationSamples(where, args, lat, lon, eirp, calibrationSampleLimit-len(samples))
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, older...)
+	}
+
+	return samples, nil
+}
+
+// getDailyCalibrationSamples tops up the samples from the daily aggregates
+// once the raw reports have expired, with one sample per cell and day at the
+// cell centre and mean RSSI.
+func getDailyCalibrationSamples(where string, args []any, lat, lon, eirp float64, limit int) ([]propagation.Sample, error) {
+	ctx := context.Background()
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT
+			geohash,
+			sum(rssi_sum) / sum(reports)
+		FROM repeater_reports_daily
+		WHERE %s AND day < toDate(?)
+		GROUP BY day, geohash
+		ORDER BY day DESC
+		LIMIT ?
+	`, where), append(args, rawDataCutoff(time.Now()), limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily reports: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []propagation.Sample
+	for rows.Next() {
+		var hash string
+		var rssi float64
+		if err := rows.Scan(&hash, &rssi); err != nil {
+			return nil, fmt.Errorf("failed to scan daily report: %w", err)
+		}
+
+		sLat, sLon := geohash.DecodeCenter(hash)
+
+		samples = append(samples, propagation.Sample{
+			DistanceKm: geodesy.Distance(lat, lon, sLat, sLon),
+			PathLossDB: eirp - rssi,
+		})
+	}
+
+	return samples, rows.Err()
+}
+
+func valueOr(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
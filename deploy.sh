@@ -18,19 +18,22 @@ fi
 echo "✓ .env file found"
 
 echo ""
-echo "=== Downloading geocoding data ==="
+echo "=== Downloading admin boundaries ==="
 if [ ! -d "data" ]; then
     mkdir -p data
 fi
 
-if [ ! -f "data/cities15000.txt" ]; then
-    echo "Downloading cities15000.zip from GeoNames..."
-    curl -L -o data/cities15000.zip https://download.geonames.org/export/dump/cities15000.zip
-    echo "Extracting archive..."
-    cd data && unzip -o cities15000.zip && cd ..
-    echo "✓ Geocoding data downloaded and extracted"
+# GeoNames cities and names are fetched and compiled into the image by the
+# Docker build when missing from data/.
+
+if [ ! -d "data/boundaries" ]; then
+    echo "Downloading admin boundaries from Natural Earth..."
+    mkdir -p data/boundaries
+    curl -L -o data/boundaries/ne_10m_admin_0_countries.geojson https://raw.githubusercontent.com/nvkelso/natural-earth-vector/master/geojson/ne_10m_admin_0_countries.geojson
+    curl -L -o data/boundaries/ne_10m_admin_1_states_provinces.geojson https://raw.githubusercontent.com/nvkelso/natural-earth-vector/master/geojson/ne_10m_admin_1_states_provinces.geojson
+    echo "✓ Admin boundaries downloaded"
 else
-    echo "✓ Geocoding data already exists"
+    echo "✓ Admin boundaries already exist"
 fi
 
 echo ""
@@ -40,9 +43,20 @@ echo "✓ Go build completed"
 
 echo ""
 echo "=== Building Docker image ==="
-docker build -t $IMAGE_NAME .
+docker build \
+    --build-arg GIT_COMMIT="$(git rev-parse HEAD 2>/dev/null || echo unknown)" \
+    --build-arg BUILD_TIME="$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+    -t $IMAGE_NAME .
 echo "✓ Docker image built: $IMAGE_NAME"
 
+echo ""
+echo "=== Running database migrations ==="
+# Schemas set up by hand before migrate existed hold 001-004; 005-009 only add
+# missing columns and tables, so they run. The baseline is ignored once
+# schema_migrations exists and on an empty database.
+docker run --rm --env-file .env $IMAGE_NAME ./server migrate -baseline 004
+echo "✓ Migrations applied"
+
 echo ""
 echo "=== Stopping and removing existing container (if any) ==="
 if docker ps -a --format '{{.Names}}' | grep -q "^${CONTAINER_NAME}$"; then
@@ -72,4 +86,6 @@ docker ps --filter "name=$CONTAINER_NAME" --format "table {{.Names}}\t{{.Status}
 
 echo ""
 echo "To view logs, run: docker logs -f $CONTAINER_NAME"
+echo "To check health, run: docker inspect --format '{{json .State.Health}}' $CONTAINER_NAME"
 echo "To stop the container, run: docker stop $CONTAINER_NAME"
+echo "To reload geocoding data, run: docker kill -s HUP $CONTAINER_NAME"
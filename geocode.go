@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"meshcore-map-api/internal/geocoder"
+)
+
+const (
+	defaultNearbyLimit = 10
+	maxNearbyLimit     = 100
+	defaultSearchLimit = 10
+)
+
+type GeocodeQuery struct {
+	Lat *float64 `form:"lat" validate:"required,min=-90,max=90"`
+	Lon *float64 `form:"lon" validate:"required,min=-180,max=180"`
+}
+
+type NearbyQuery struct {
+	GeocodeQuery
+	K        int     `form:"k" validate:"omitempty,min=1,max=100"`
+	RadiusKm float64 `form:"radius_km" validate:"omitempty,gt=0,max=500"`
+}
+
+type PlaceSearchQuery struct {
+	Q       string `form:"q" validate:"required,max=100"`
+	Country string `form:"country" validate:"omitempty,len=2,alpha"`
+	Limit   int    `form:"limit" validate:"omitempty,min=1,max=50"`
+}
+
+func geocoderOptions() geocoder.Options {
+	return geocoder.Options{
+		DataDir:       cfg.Geocoder.DataDir,
+		Cities:        cfg.Geocoder.Cities,
+		Snapshot:      cfg.Geocoder.Snapshot,
+		BoundariesDir: cfg.Geocoder.BoundariesDir,
+	}
+}
+
+func requireGeocoder(c *gin.Context) bool {
+	if !geo.Ready() {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Geocoding data not loaded"})
+		return false
+	}
+	return true
+}
+
+func handleGeocode(c *gin.Context) {
+	var query GeocodeQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !requireGeocoder(c) {
+		return
+	}
+
+	result, ok := geo.Lookup(*query.Lat, *query.Lon)
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No city within range"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func handleGeocodeNearby(c *gin.Context) {
+	var query NearbyQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !requireGeocoder(c) {
+		return
+	}
+
+	var results []geocoder.Result
+	if query.RadiusKm > 0 {
+		results = geo.WithinRadius(*query.Lat, *query.Lon, query.RadiusKm)
+		if limit := intValueOr(query.K, maxNearbyLimit); len(results) > limit {
+			results = results[:limit]
+		}
+	} else {
+		results = geo.Nearest(*query.Lat, *query.Lon, intValueOr(query.K, defaultNearbyLimit))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func handlePlaceSearch(c *gin.Context) {
+	var query PlaceSearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !requireGeocoder(c) {
+		return
+	}
+
+	places := geo.Search(query.Q, query.Country, intValueOr(query.Limit, defaultSearchLimit))
+
+	c.JSON(http.StatusOK, gin.H{"results": places})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Set at build time with -ldflags "-X main.commit=... -X main.buildTime=...".
+// Without them, the VCS information stamped by the Go toolchain is used.
+var (
+	commit    string
+	buildTime string
+)
+
+// schemaVersion is the number of the latest migration in sql/clickhouse this
+// build relies on.
+const schemaVersion = "013"
+
+const readinessTimeout = 2 * time.Second
+
+type VersionResponse struct {
+	Commit               string `json:"commit"`
+	BuildTime            string `json:"buildTime"`
+	GoVersion            string `json:"goVersion"`
+	SchemaVersion        string `json:"schemaVersion"`
+	AppliedSchemaVersion string `json:"appliedSchemaVersion,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && commit == "":
+			commit = setting.Value
+		case setting.Key == "vcs.time" && buildTime == "":
+			buildTime = setting.Value
+		}
+	}
+}
+
+func handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleReadyz reports whether the server can ingest and serve data: the
+// database answers, geocoding data is loaded and the schema is migrated.
+func handleReadyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	response := ReadinessResponse{Status: "ready", Checks: make(map[string]string)}
+	check := func(name string, err error) {
+		if err != nil {
+			response.Status = "not_ready"
+			response.Checks[name] = err.Error()
+			return
+		}
+		response.Checks[name] = "ok"
+	}
+
+	check("clickhouse", db.Ping(ctx))
+
+	if status := geo.Status(); !status.Ready {
+		check("geocoder", fmt.Errorf("not loaded: %s", cmp.Or(status.Error, "no data")))
+	} else {
+		check("geocoder", nil)
+	}
+
+	applied, err := getSchemaVersion(ctx)
+	if err == nil && !schemaVersionApplied(applied, schemaVersion) {
+		err = fmt.Errorf("at %s, expected %s", cmp.Or(applied, "none"), schemaVersion)
+	}
+	check("schema", err)
+
+	if response.Status != "ready" {
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func handleVersion(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	// The applied version is informational, so an unreachable database
+	// doesn't fail the request.
+	applied, _ := getSchemaVersion(ctx)
+
+	c.JSON(http.StatusOK, VersionResponse{
+		Commit:               cmp.Or(commit, "unknown"),
+		BuildTime:            cmp.Or(buildTime, "unknown"),
+		GoVersion:            strings.TrimPrefix(runtime.Version(), "go"),
+		SchemaVersion:        schemaVersion,
+		AppliedSchemaVersion: applied,
+	})
+}
+
+// getSchemaVersion returns the latest migration recorded by migrate, e.g.
+// "010_create_daily_aggregates", or "" if none was.
+func getSchemaVersion(ctx context.Context) (string, error) {
+	var version string
+	err := db.QueryRow(ctx, fmt.Sprintf("SELECT max(version) FROM %s", migrationsTable)).Scan(&version)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	return version, nil
+}
+
+// schemaVersionApplied reports whether the applied migration is expected or
+// a later one. Migration numbers are zero-padded, so they compare as strings.
+func schemaVersionApplied(applied, expected string) bool {
+	if applied == "" {
+		return false
+	}
+	number, _, _ := strings.Cut(applied, "_")
+	return number >= expected
+}
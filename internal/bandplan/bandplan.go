@@ -0,0 +1,225 @@
+package bandplan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	StatusCompliant      = "compliant"
+	StatusOutOfBand      = "out_of_band"
+	StatusOverPower      = "over_power"
+	StatusUnknownCountry = "unknown_country"
+	// StatusPowerUnknown is a channel inside a sub-band sent at an unknown
+	// TX power, which can't be checked against the EIRP limit.
+	StatusPowerUnknown = "power_unknown"
+)
+
+// ERP limits are converted to EIRP (+2.15 dB). Reported TX power is compared
+// against EIRP assuming a 0 dBi antenna, since reporters don't send antenna gain.
+const erpToEIRP = 2.15
+
+type SubBand struct {
+	MinMHz       float64 `json:"minMHz"`
+	MaxMHz       float64 `json:"maxMHz"`
+	MaxEIRPDBm   float64 `json:"maxEirpDbm"`
+	DutyCyclePct float64 `json:"dutyCyclePct,omitempty"`
+}
+
+type Plan struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	SubBands []SubBand `json:"subBands"`
+}
+
+var Plans = []Plan{
+	{
+		ID:   "EU868",
+		Name: "Europe 863-870 MHz (ETSI EN 300 220)",
+		SubBands: []SubBand{
+			{MinMHz: 863.0, MaxMHz: 865.0, MaxEIRPDBm: 14 + erpToEIRP, DutyCyclePct: 0.1},
+			{MinMHz: 865.0, MaxMHz: 868.0, MaxEIRPDBm: 14 + erpToEIRP, DutyCyclePct: 1},
+			{MinMHz: 868.0, MaxMHz: 868.6, MaxEIRPDBm: 14 + erpToEIRP, DutyCyclePct: 1},
+			{MinMHz: 868.7, MaxMHz: 869.2, MaxEIRPDBm: 14 + erpToEIRP, DutyCyclePct: 0.1},
+			{MinMHz: 869.4, MaxMHz: 869.65, MaxEIRPDBm: 27 + erpToEIRP, DutyCyclePct: 10},
+			{MinMHz: 869.7, MaxMHz: 870.0, MaxEIRPDBm: 14 + erpToEIRP, DutyCyclePct: 1},
+		},
+	},
+	{
+		ID:   "EU433",
+		Name: "Europe 433 MHz",
+		SubBands: []SubBand{
+			{MinMHz: 433.05, MaxMHz: 434.79, MaxEIRPDBm: 10 + erpToEIRP, DutyCyclePct: 10},
+		},
+	},
+	{
+		ID:   "US915",
+		Name: "United States 902-928 MHz (FCC Part 15.247)",
+		SubBands: []SubBand{
+			{MinMHz: 902.0, MaxMHz: 928.0, MaxEIRPDBm: 36},
+		},
+	},
+	{
+		ID:   "AU915",
+		Name: "Australia 915-928 MHz",
+		SubBands: []SubBand{
+			{MinMHz: 915.0, MaxMHz: 928.0, MaxEIRPDBm: 30},
+		},
+	},
+	{
+		ID:   "AS923",
+		Name: "Asia 920-923 MHz",
+		SubBands: []SubBand{
+			{MinMHz: 920.0, MaxMHz: 923.0, MaxEIRPDBm: 16},
+		},
+	},
+	{
+		ID:   "IN865",
+		Name: "India 865-867 MHz",
+		SubBands: []SubBand{
+			{MinMHz: 865.0, MaxMHz: 867.0, MaxEIRPDBm: 30 + erpToEIRP},
+		},
+	},
+	{
+		ID:   "KR920",
+		Name: "South Korea 920-923 MHz",
+		SubBands: []SubBand{
+			{MinMHz: 920.9, MaxMHz: 923.3, MaxEIRPDBm: 14},
+		},
+	},
+	{
+		ID:   "RU864",
+		Name: "Russia 864-870 MHz",
+		SubBands: []SubBand{
+			{MinMHz: 864.0, MaxMHz: 865.0, MaxEIRPDBm: 14 + erpToEIRP, DutyCyclePct: 0.1},
+			{MinMHz: 868.7, MaxMHz: 869.2, MaxEIRPDBm: 14 + erpToEIRP, DutyCyclePct: 1},
+		},
+	},
+}
+
+var countryPlans = map[string][]string{}
+
+func init() {
+	europe := []string{
+		"AD", "AL", "AT", "BA", "BE", "BG", "CH", "CY", "CZ", "DE", "DK", "EE", "ES", "FI",
+		"FO", "FR", "GB", "GI", "GR", "HR", "HU", "IE", "IM", "IS", "IT", "JE", "GG", "LI",
+		"LT", "LU", "LV", "MC", "MD", "ME", "MK", "MT", "NL", "NO", "PL", "PT", "RO", "RS",
+		"SE", "SI", "SK", "SM", "TR", "UA", "VA", "XK",
+	}
+	for _, cc := range europe {
+		countryPlans[cc] = []string{"EU868", "EU433"}
+	}
+
+	assign := func(plan string, countries ...string) {
+		for _, cc := range countries {
+			countryPlans[cc] = append(countryPlans[cc], plan)
+		}
+	}
+
+	assign("US915", "US", "CA", "MX", "PR")
+	assign("AU915", "AU", "NZ", "BR", "AR", "CL", "UY")
+	assign("AS923", "JP", "SG", "TH", "VN", "MY", "ID", "PH", "TW", "HK")
+	assign("IN865", "IN")
+	assign("KR920", "KR")
+	assign("RU864", "RU")
+}
+
+func FindPlan(id string) (Plan, bool) {
+	for _, p := range Plans {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Plan{}, false
+}
+
+func PlansForCountry(countryCode string) []Plan {
+	var plans []Plan
+	for _, id := range countryPlans[strings.ToUpper(countryCode)] {
+		if p, ok := FindPlan(id); ok {
+			plans = append(plans, p)
+		}
+	}
+	return plans
+}
+
+func Countries() []string {
+	countries := make([]string, 0, len(countryPlans))
+	for cc := range countryPlans {
+		countries = append(countries, cc)
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+type Result struct {
+	Status  string   `json:"status"`
+	Plan    string   `json:"plan,omitempty"`
+	SubBand *SubBand `json:"subBand,omitempty"`
+	Issues  []string `json:"issues,omitempty"`
+}
+
+// Check validates a channel (centre frequency and bandwidth in kHz) and TX
+// power against the band plans of a country. The whole occupied bandwidth must
+// fall inside one sub-band.
+func Check(countryCode string, freqMHz, bwKHz float64, txDBm int) Result {
+	result := CheckChannel(countryCode, freqMHz, bwKHz)
+	if result.Status != StatusPowerUnknown {
+		return result
+	}
+
+	if float64(txDBm) > result.SubBand.MaxEIRPDBm {
+		result.Status = StatusOverPower
+		result.Issues = []string{fmt.Sprintf("TX power %d dBm exceeds %.2f dBm EIRP limit", txDBm, result.SubBand.MaxEIRPDBm)}
+		return result
+	}
+
+	result.Status = StatusCompliant
+	return result
+}
+
+// CheckChannel validates a channel like Check when the TX power is not known:
+// a channel inside a sub-band is power_unknown rather than compliant.
+func CheckChannel(countryCode string, freqMHz, bwKHz float64) Result {
+	plans := PlansForCountry(countryCode)
+	if len(plans) == 0 {
+		return Result{Status: StatusUnknownCountry}
+	}
+
+	low := freqMHz - bwKHz/2000
+	high := freqMHz + bwKHz/2000
+
+	for _, plan := range plans {
+		for i := range plan.SubBands {
+			sb := plan.SubBands[i]
+			if low < sb.MinMHz || high > sb.MaxMHz {
+				continue
+			}
+			return Result{Status: StatusPowerUnknown, Plan: plan.ID, SubBand: &sb}
+		}
+	}
+
+	return Result{
+		Status: StatusOutOfBand,
+		Plan:   plans[0].ID,
+		Issues: []string{fmt.Sprintf("channel %.3f-%.3f MHz is outside the %s band plan", low, high, strings.ToUpper(countryCode))},
+	}
+}
+
+// Severity orders statuses from best to worst, for summarising many reports.
+func Severity(status string) int {
+	switch status {
+	case StatusCompliant:
+		return 0
+	case StatusPowerUnknown:
+		return 1
+	case StatusUnknownCountry:
+		return 2
+	case StatusOverPower:
+		return 3
+	case StatusOutOfBand:
+		return 4
+	}
+	return 2
+}
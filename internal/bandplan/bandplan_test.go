@@ -0,0 +1,68 @@
+package bandplan
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		country string
+		freq    float64
+		bw      float64
+		tx      int
+		status  string
+		plan    string
+	}{
+		{"EU narrow preset in Bulgaria", "BG", 869.618, 62.5, 22, StatusCompliant, "EU868"},
+		{"EU narrow preset at 30 dBm", "BG", 869.618, 62.5, 30, StatusOverPower, "EU868"},
+		{"250 kHz channel crossing sub-band edge", "BG", 869.618, 250, 22, StatusOutOfBand, "EU868"},
+		{"US preset in Bulgaria", "BG", 910.525, 62.5, 22, StatusOutOfBand, "EU868"},
+		{"EU 433 in Portugal", "PT", 433.375, 62.5, 10, StatusCompliant, "EU433"},
+		{"US preset in US", "US", 910.525, 62.5, 30, StatusCompliant, "US915"},
+		{"Lower case country", "us", 910.525, 62.5, 30, StatusCompliant, "US915"},
+		{"Australia narrow", "AU", 916.575, 62.5, 22, StatusCompliant, "AU915"},
+		{"Unknown country", "", 869.618, 62.5, 22, StatusUnknownCountry, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(tt.country, tt.freq, tt.bw, tt.tx)
+			if got.Status != tt.status {
+				t.Errorf("Expected status %s, got %s (%v)", tt.status, got.Status, got.Issues)
+			}
+			if got.Plan != tt.plan {
+				t.Errorf("Expected plan %s, got %s", tt.plan, got.Plan)
+			}
+		})
+	}
+}
+
+func TestCheckChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		country string
+		freq    float64
+		bw      float64
+		status  string
+	}{
+		{"EU narrow preset in Bulgaria", "BG", 869.618, 62.5, StatusPowerUnknown},
+		{"US preset in Bulgaria", "BG", 910.525, 62.5, StatusOutOfBand},
+		{"Unknown country", "", 869.618, 62.5, StatusUnknownCountry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CheckChannel(tt.country, tt.freq, tt.bw)
+			if got.Status != tt.status {
+				t.Errorf("Expected status %s, got %s (%v)", tt.status, got.Status, got.Issues)
+			}
+		})
+	}
+}
+
+func TestCountryPlansExist(t *testing.T) {
+	for _, cc := range Countries() {
+		if len(PlansForCountry(cc)) == 0 {
+			t.Errorf("Country %s maps to no known plan", cc)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, args, err := Load(nil, env(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(args) != 0 {
+		t.Errorf("Expected no arguments left, got %q", args)
+	}
+	if cfg.Server.Addr != ":8080" || cfg.ClickHouse.MaxOpenConns != 10 || time.Duration(cfg.ClickHouse.MaxExecutionTime) != time.Minute {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	file := `
+server:
+  addr: ":9000"
+clickhouse:
+  host: file-host
+  port: 9440
+  max_execution_time: 2m
+geocoder:
+  cities: [cities500.txt, extra.txt]
+`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, args, err := Load(
+		[]string{"-config", path, "-clickhouse.host", "flag-host", "migrate", "-dir", "sql"},
+		env(map[string]string{"CLICKHOUSE_HOST": "env-host", "CLICKHOUSE_PORT": "9441", "STORE_PRECISE_LOCATION": "false"}),
+	)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Server.Addr != ":9000" {
+		t.Errorf("Expected the address from the file, got %q", cfg.Server.Addr)
+	}
+	if cfg.ClickHouse.Port != 9441 {
+		t.Errorf("Expected the port from the environment, got %d", cfg.ClickHouse.Port)
+	}
+	if cfg.ClickHouse.Host != "flag-host" {
+		t.Errorf("Expected the host from the flag, got %q", cfg.ClickHouse.Host)
+	}
+	if time.Duration(cfg.ClickHouse.MaxExecutionTime) != 2*time.Minute {
+		t.Errorf("Expected max_execution_time 2m, got %v", time.Duration(cfg.ClickHouse.MaxExecutionTime))
+	}
+	if strings.Join(cfg.Geocoder.Cities, ",") != "cities500.txt,extra.txt" {
+		t.Errorf("Unexpected cities %q", cfg.Geocoder.Cities)
+	}
+	if cfg.Privacy.StorePreciseLocation {
+		t.Error("Expected precise location to be disabled")
+	}
+	if strings.Join(args, " ") != "migrate -dir sql" {
+		t.Errorf("Unexpected arguments left: %q", args)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	file := `
+[clickhouse]
+host = "toml-host"
+conn_max_lifetime = "30m"
+
+[retention]
+raw_days = 0
+`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := Load(nil, env(map[string]string{"CONFIG_FILE": path}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.ClickHouse.Host != "toml-host" || time.Duration(cfg.ClickHouse.ConnMaxLifetime) != 30*time.Minute || cfg.Retention.RawDays != 0 {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+}
+
+func TestStorePreciseLocationEnv(t *testing.T) {
+	// Only "false" disables it, as before the typed configuration.
+	tests := map[string]bool{"false": false, "true": true, "0": true, "no": true, "yes": true}
+
+	for value, want := range tests {
+		cfg, _, err := Load(nil, env(map[string]string{"STORE_PRECISE_LOCATION": value}))
+		if err != nil {
+			t.Fatalf("Load with STORE_PRECISE_LOCATION=%s: %v", value, err)
+		}
+		if cfg.Privacy.StorePreciseLocation != want {
+			t.Errorf("STORE_PRECISE_LOCATION=%s: expected %v, got %v", value, want, cfg.Privacy.StorePreciseLocation)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("clickhouse:\n  hots: typo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"Unknown file key", []string{"-config", path}, nil, "hots"},
+		{"Malformed number", nil, map[string]string{"CLICKHOUSE_PORT": "ninety"}, "CLICKHOUSE_PORT"},
+		{"Malformed duration", []string{"-server.read_timeout", "soon"}, nil, "-server.read_timeout"},
+		{"Out of range", []string{"-clickhouse.port", "70000"}, nil, "clickhouse.port: max=65535"},
+		{"Cross-field", []string{"-clickhouse.max_idle_conns", "20"}, nil, "clickhouse.max_idle_conns: ltefield=MaxOpenConns"},
+		{"Unknown protocol", nil, map[string]string{"CLICKHOUSE_PROTOCOL": "grpc"}, "clickhouse.protocol: oneof=native http"},
+		{"Missing file", []string{"-clickhouse.tls.ca_file", "/nonexistent/ca.pem"}, nil, "clickhouse.tls.ca_file: file"},
+		{"Client certificate without key", []string{"-clickhouse.tls.cert_file", path}, nil, "clickhouse.tls.key_file: required_with=CertFile"},
+		{"Unknown log level", nil, map[string]string{"LOG_LEVEL": "verbose"}, "log.level: oneof=debug info warn error"},
+		{"Replicas without a path", []string{"-clickhouse.cluster", "mesh", "-clickhouse.replica_path", ""}, nil, "clickhouse.replica_path: required_with=Cluster"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Load(tt.args, env(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.ClickHouse.Password = "hunter2"
+	cfg.Admin.Token = "token"
+
+	out, err := cfg.Redacted().YAML()
+	if err != nil {
+		t.Fatalf("YAML: %v", err)
+	}
+	for _, secret := range []string{"hunter2", "token: token"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("Expected %q to be redacted:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(string(out), "password: REDACTED") || !strings.Contains(string(out), "location_fuzz_key: \"\"") {
+		t.Errorf("Expected set secrets redacted and unset ones empty:\n%s", out)
+	}
+	if cfg.ClickHouse.Password != "hunter2" {
+		t.Error("Redacted modified the original")
+	}
+	if !strings.Contains(string(out), "max_execution_time: 1m0s") {
+		t.Errorf("Expected durations as strings:\n%s", out)
+	}
+}
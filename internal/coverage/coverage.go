@@ -0,0 +1,192 @@
+package coverage
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	"meshcore-map-api/internal/geodesy"
+	"meshcore-map-api/internal/propagation"
+)
+
+const (
+	MaxCells        = 250000
+	metersPerDegree = 111320.0
+	rampSpanDB      = 40.0
+)
+
+type Params struct {
+	Lat            float64
+	Lon            float64
+	RadiusKm       float64
+	CellSizeM      float64
+	TxPowerDBm     float64
+	TxGainDBi      float64
+	RxGainDBi      float64
+	SensitivityDBm float64
+	Model          propagation.Model
+}
+
+type Cell struct {
+	Row  int
+	Col  int
+	Lat  float64
+	Lon  float64
+	RSSI float64
+}
+
+type Grid struct {
+	Params  Params
+	Rows    int
+	Cols    int
+	MinLat  float64
+	MinLon  float64
+	MaxLat  float64
+	MaxLon  float64
+	LatStep float64
+	LonStep float64
+	Cells   []Cell
+}
+
+func Predict(p Params) (*Grid, error) {
+	if p.Model == nil {
+		return nil, errors.New("propagation model is required")
+	}
+	if p.RadiusKm <= 0 || p.CellSizeM <= 0 {
+		return nil, errors.New("radius and cell size must be positive")
+	}
+
+	size := int(math.Ceil(2 * p.RadiusKm * 1000 / p.CellSizeM))
+	if size*size > MaxCells {
+		return nil, fmt.Errorf("grid of %dx%d cells exceeds limit of %d cells", size, size, MaxCells)
+	}
+
+	cosLat := math.Max(math.Cos(p.Lat*math.Pi/180), 0.01)
+	latStep := p.CellSizeM / metersPerDegree
+	lonStep := p.CellSizeM / (metersPerDegree * cosLat)
+
+	g := &Grid{
+		Params:  p,
+		Rows:    size,
+		Cols:    size,
+		LatStep: latStep,
+		LonStep: lonStep,
+		MaxLat:  p.Lat + float64(size)*latStep/2,
+		MinLon:  p.Lon - float64(size)*lonStep/2,
+	}
+	g.MinLat = g.MaxLat - float64(size)*latStep
+	g.MaxLon = g.MinLon + float64(size)*lonStep
+
+	eirp := p.TxPowerDBm + p.TxGainDBi + p.RxGainDBi
+
+	for row := 0; row < size; row++ {
+		lat := g.MaxLat - (float64(row)+0.5)*latStep
+		for col := 0; col < size; col++ {
+			lon := g.MinLon + (float64(col)+0.5)*lonStep
+
+			d := geodesy.Distance(p.Lat, p.Lon, lat, lon)
+			if d > p.RadiusKm {
+				continue
+			}
+
+			g.Cells = append(g.Cells, Cell{
+				Row:  row,
+				Col:  col,
+				Lat:  lat,
+				Lon:  geodesy.NormalizeLon(lon),
+				RSSI: eirp - p.Model.PathLoss(d),
+			})
+		}
+	}
+
+	return g, nil
+}
+
+type FeatureCollection struct {
+	Type     string         `json:"type"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+	Features []Feature      `json:"features"`
+}
+
+type Feature struct {
+	Type       string         `json:"type"`
+	Geometry   Geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type Geometry struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// GeoJSON returns the cells that are above the receiver sensitivity as polygons.
+func (g *Grid) GeoJSON() FeatureCollection {
+	fc := FeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]Feature, 0, len(g.Cells)),
+	}
+
+	halfLat := g.LatStep / 2
+	halfLon := g.LonStep / 2
+
+	for _, c := range g.Cells {
+		margin := c.RSSI - g.Params.SensitivityDBm
+		if margin < 0 {
+			continue
+		}
+
+		ring := [][2]float64{
+			{c.Lon - halfLon, c.Lat - halfLat},
+			{c.Lon + halfLon, c.Lat - halfLat},
+			{c.Lon + halfLon, c.Lat + halfLat},
+			{c.Lon - halfLon, c.Lat + halfLat},
+			{c.Lon - halfLon, c.Lat - halfLat},
+		}
+
+		fc.Features = append(fc.Features, Feature{
+			Type: "Feature",
+			Geometry: Geometry{
+				Type:        "Polygon",
+				Coordinates: [][][2]float64{ring},
+			},
+			Properties: map[string]any{
+				"rssi":   round1(c.RSSI),
+				"margin": round1(margin),
+			},
+		})
+	}
+
+	return fc
+}
+
+// PNG renders the grid north-up, one pixel per cell, transparent where the
+// predicted RSSI is below sensitivity.
+func (g *Grid) PNG(w io.Writer) error {
+	img := image.NewNRGBA(image.Rect(0, 0, g.Cols, g.Rows))
+
+	for _, c := range g.Cells {
+		margin := c.RSSI - g.Params.SensitivityDBm
+		if margin < 0 {
+			continue
+		}
+		img.SetNRGBA(c.Col, c.Row, rampColor(margin/rampSpanDB))
+	}
+
+	return png.Encode(w, img)
+}
+
+func rampColor(t float64) color.NRGBA {
+	t = math.Max(0, math.Min(1, t))
+	if t < 0.5 {
+		return color.NRGBA{R: 255, G: uint8(510 * t), B: 0, A: 160}
+	}
+	return color.NRGBA{R: uint8(510 * (1 - t)), G: 255, B: 0, A: 160}
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,84 @@
+package coverage
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"meshcore-map-api/internal/propagation"
+)
+
+func testParams() Params {
+	return Params{
+		Lat:            42.6977,
+		Lon:            23.3219,
+		RadiusKm:       2,
+		CellSizeM:      200,
+		TxPowerDBm:     22,
+		SensitivityDBm: -130,
+		Model:          propagation.FreeSpace{FreqMHz: 869.618},
+	}
+}
+
+func TestPredict(t *testing.T) {
+	g, err := Predict(testParams())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if g.Rows != 20 || g.Cols != 20 {
+		t.Errorf("Expected 20x20 grid, got %dx%d", g.Rows, g.Cols)
+	}
+	if len(g.Cells) == 0 || len(g.Cells) >= g.Rows*g.Cols {
+		t.Errorf("Expected circular subset of cells, got %d", len(g.Cells))
+	}
+
+	var center, edge Cell
+	for _, c := range g.Cells {
+		if c.Row == 10 && c.Col == 10 {
+			center = c
+		}
+		if c.Row == 10 && c.Col == 19 {
+			edge = c
+		}
+	}
+	if center.RSSI <= edge.RSSI {
+		t.Errorf("Expected RSSI to decrease with distance, center %.1f edge %.1f", center.RSSI, edge.RSSI)
+	}
+}
+
+func TestPredictTooManyCells(t *testing.T) {
+	p := testParams()
+	p.RadiusKm = 100
+	p.CellSizeM = 50
+
+	if _, err := Predict(p); err == nil {
+		t.Errorf("Expected error for oversized grid")
+	}
+}
+
+func TestGeoJSONAndPNG(t *testing.T) {
+	p := testParams()
+	p.SensitivityDBm = -70
+	g, err := Predict(p)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fc := g.GeoJSON()
+	if len(fc.Features) == 0 || len(fc.Features) >= len(g.Cells) {
+		t.Errorf("Expected only cells above sensitivity, got %d of %d", len(fc.Features), len(g.Cells))
+	}
+
+	var buf bytes.Buffer
+	if err := g.PNG(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if img.Bounds().Dx() != g.Cols || img.Bounds().Dy() != g.Rows {
+		t.Errorf("Expected %dx%d image, got %v", g.Cols, g.Rows, img.Bounds())
+	}
+}
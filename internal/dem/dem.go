@@ -0,0 +1,166 @@
+package dem
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	voidValue       = -32768
+	defaultMaxTiles = 16
+)
+
+var ErrNoData = errors.New("no elevation data")
+
+type tile struct {
+	key  string
+	size int
+	data []int16
+}
+
+type DEM struct {
+	dir      string
+	maxTiles int
+
+	mu      sync.Mutex
+	tiles   map[string]*list.Element
+	lru     *list.List
+	missing map[string]bool
+}
+
+func New(dir string) *DEM {
+	return &DEM{
+		dir:      dir,
+		maxTiles: defaultMaxTiles,
+		tiles:    make(map[string]*list.Element),
+		lru:      list.New(),
+		missing:  make(map[string]bool),
+	}
+}
+
+func (d *DEM) Available() bool {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".hgt" {
+			return true
+		}
+	}
+	return false
+}
+
+func tileKey(lat, lon float64) string {
+	latF := int(math.Floor(lat))
+	lonF := int(math.Floor(lon))
+
+	ns, ew := 'N', 'E'
+	if latF < 0 {
+		ns = 'S'
+		latF = -latF
+	}
+	if lonF < 0 {
+		ew = 'W'
+		lonF = -lonF
+	}
+
+	return fmt.Sprintf("%c%02d%c%03d", ns, latF, ew, lonF)
+}
+
+func (d *DEM) getTile(lat, lon float64) (*tile, error) {
+	key := tileKey(lat, lon)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if el, ok := d.tiles[key]; ok {
+		d.lru.MoveToFront(el)
+		return el.Value.(*tile), nil
+	}
+	if d.missing[key] {
+		return nil, ErrNoData
+	}
+
+	t, err := loadTile(filepath.Join(d.dir, key+".hgt"), key)
+	if errors.Is(err, os.ErrNotExist) {
+		d.missing[key] = true
+		return nil, ErrNoData
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.tiles[key] = d.lru.PushFront(t)
+	if d.lru.Len() > d.maxTiles {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		delete(d.tiles, oldest.Value.(*tile).key)
+	}
+
+	return t, nil
+}
+
+func loadTile(path, key string) (*tile, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := len(raw) / 2
+	size := int(math.Sqrt(float64(samples)))
+	if size*size != samples || (size != 1201 && size != 3601) {
+		return nil, fmt.Errorf("unexpected HGT tile size in %s: %d bytes", path, len(raw))
+	}
+
+	data := make([]int16, samples)
+	for i := range data {
+		data[i] = int16(binary.BigEndian.Uint16(raw[i*2:]))
+	}
+
+	return &tile{key: key, size: size, data: data}, nil
+}
+
+func (t *tile) at(row, col int) (float64, bool) {
+	v := t.data[row*t.size+col]
+	if v == voidValue {
+		return 0, false
+	}
+	return float64(v), true
+}
+
+// Elevation returns the bilinearly interpolated terrain height in meters.
+func (d *DEM) Elevation(lat, lon float64) (float64, error) {
+	t, err := d.getTile(lat, lon)
+	if err != nil {
+		return 0, err
+	}
+
+	n := float64(t.size - 1)
+	y := (math.Floor(lat) + 1 - lat) * n
+	x := (lon - math.Floor(lon)) * n
+
+	r0 := int(math.Min(math.Floor(y), n-1))
+	c0 := int(math.Min(math.Floor(x), n-1))
+	fy := y - float64(r0)
+	fx := x - float64(c0)
+
+	v00, ok00 := t.at(r0, c0)
+	v01, ok01 := t.at(r0, c0+1)
+	v10, ok10 := t.at(r0+1, c0)
+	v11, ok11 := t.at(r0+1, c0+1)
+	if !ok00 || !ok01 || !ok10 || !ok11 {
+		return 0, ErrNoData
+	}
+
+	top := v00*(1-fx) + v01*fx
+	bottom := v10*(1-fx) + v11*fx
+
+	return top*(1-fy) + bottom*fy, nil
+}
@@ -0,0 +1,112 @@
+package dem
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testTileSize = 1201
+
+// writeTile creates a synthetic N42E023 tile with a flat plain at 500 m and a
+// north-south ridge of the given height at longitude 23.5.
+func writeTile(t *testing.T, ridge int16) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	buf := make([]byte, testTileSize*testTileSize*2)
+	for row := 0; row < testTileSize; row++ {
+		for col := 0; col < testTileSize; col++ {
+			v := int16(500)
+			if col >= 598 && col <= 602 {
+				v = ridge
+			}
+			binary.BigEndian.PutUint16(buf[(row*testTileSize+col)*2:], uint16(v))
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "N42E023.hgt"), buf, 0o644); err != nil {
+		t.Fatalf("Failed to write tile: %v", err)
+	}
+
+	return dir
+}
+
+func TestTileKey(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		key      string
+	}{
+		{42.69, 23.32, "N42E023"},
+		{-33.9, 151.2, "S34E151"},
+		{40.7, -74.0, "N40W074"},
+	}
+
+	for _, tt := range tests {
+		if got := tileKey(tt.lat, tt.lon); got != tt.key {
+			t.Errorf("tileKey(%f, %f) = %s, expected %s", tt.lat, tt.lon, got, tt.key)
+		}
+	}
+}
+
+func TestElevation(t *testing.T) {
+	d := New(writeTile(t, 1500))
+
+	if !d.Available() {
+		t.Fatalf("Expected DEM to be available")
+	}
+
+	elev, err := d.Elevation(42.5, 23.2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if math.Abs(elev-500) > 0.01 {
+		t.Errorf("Expected 500 m, got %.2f", elev)
+	}
+
+	elev, err = d.Elevation(42.5, 23.5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if math.Abs(elev-1500) > 0.01 {
+		t.Errorf("Expected 1500 m on ridge, got %.2f", elev)
+	}
+
+	if _, err := d.Elevation(10, 10); err != ErrNoData {
+		t.Errorf("Expected ErrNoData for missing tile, got %v", err)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	params := LinkParams{
+		FromLat:     42.5,
+		FromLon:     23.3,
+		FromHeightM: 60,
+		ToLat:       42.5,
+		ToLon:       23.7,
+		ToHeightM:   30,
+		FreqMHz:     869.618,
+		Samples:     200,
+	}
+
+	blocked, err := New(writeTile(t, 1500)).Analyze(params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if blocked.LineOfSight || blocked.FresnelClear {
+		t.Errorf("Expected ridge to block the link, min clearance %.2f", blocked.MinClearanceM)
+	}
+
+	clear, err := New(writeTile(t, 500)).Analyze(params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !clear.LineOfSight {
+		t.Errorf("Expected line of sight over flat terrain, min clearance %.2f", clear.MinClearanceM)
+	}
+	if clear.FresnelClear {
+		t.Errorf("Expected earth bulge to intrude into the Fresnel zone over 33 km, got ratio %.2f", clear.FresnelClearance)
+	}
+}
@@ -0,0 +1,129 @@
+package dem
+
+import (
+	"math"
+
+	"meshcore-map-api/internal/geodesy"
+)
+
+const (
+	DefaultKFactor = 4.0 / 3.0
+	speedOfLight   = 299792458.0
+)
+
+type ProfilePoint struct {
+	DistanceKm  float64 `json:"distanceKm"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	ElevationM  float64 `json:"elevationM"`
+	LineHeightM float64 `json:"lineHeightM"`
+	FresnelM    float64 `json:"fresnelM"`
+	ClearanceM  float64 `json:"clearanceM"`
+}
+
+type Analysis struct {
+	DistanceKm         float64        `json:"distanceKm"`
+	FromElevationM     float64        `json:"fromElevationM"`
+	ToElevationM       float64        `json:"toElevationM"`
+	LineOfSight        bool           `json:"lineOfSight"`
+	MinClearanceM      float64        `json:"minClearanceM"`
+	FresnelClearance   float64        `json:"fresnelClearance"`
+	FresnelClear       bool           `json:"fresnelClear"`
+	ObstructionCount   int            `json:"obstructionCount"`
+	WorstObstructionKm float64        `json:"worstObstructionKm"`
+	Profile            []ProfilePoint `json:"profile,omitempty"`
+}
+
+type LinkParams struct {
+	FromLat     float64
+	FromLon     float64
+	FromHeightM float64
+	ToLat       float64
+	ToLon       float64
+	ToHeightM   float64
+	FreqMHz     float64
+	KFactor     float64
+	Samples     int
+}
+
+// Analyze samples the terrain between two antennas and reports line-of-sight
+// and first Fresnel zone clearance, including earth curvature with the given
+// effective earth radius factor. FresnelClearance is the worst ratio of
+// clearance to first Fresnel zone radius along the path; 0.6 or more is
+// considered clear.
+func (d *DEM) Analyze(p LinkParams) (*Analysis, error) {
+	if p.Samples < 2 {
+		p.Samples = 2
+	}
+	if p.KFactor <= 0 {
+		p.KFactor = DefaultKFactor
+	}
+
+	total := geodesy.Distance(p.FromLat, p.FromLon, p.ToLat, p.ToLon)
+	totalM := total * 1000
+	wavelength := speedOfLight / (p.FreqMHz * 1e6)
+	effRadiusM := p.KFactor * geodesy.EarthRadiusKm * 1000
+
+	profile := make([]ProfilePoint, p.Samples)
+	for i := range profile {
+		f := float64(i) / float64(p.Samples-1)
+		lat, lon := geodesy.Interpolate(p.FromLat, p.FromLon, p.ToLat, p.ToLon, f)
+		elev, err := d.Elevation(lat, lon)
+		if err != nil {
+			return nil, err
+		}
+		profile[i] = ProfilePoint{DistanceKm: total * f, Lat: lat, Lon: lon, ElevationM: elev}
+	}
+
+	fromTop := profile[0].ElevationM + p.FromHeightM
+	toTop := profile[len(profile)-1].ElevationM + p.ToHeightM
+
+	a := &Analysis{
+		DistanceKm:       total,
+		FromElevationM:   profile[0].ElevationM,
+		ToElevationM:     profile[len(profile)-1].ElevationM,
+		LineOfSight:      true,
+		FresnelClear:     true,
+		MinClearanceM:    math.Inf(1),
+		FresnelClearance: math.Inf(1),
+	}
+
+	for i := range profile {
+		pt := &profile[i]
+		d1 := pt.DistanceKm * 1000
+		d2 := totalM - d1
+
+		bulge := d1 * d2 / (2 * effRadiusM)
+		pt.LineHeightM = fromTop + (toTop-fromTop)*d1/math.Max(totalM, 1)
+		pt.ClearanceM = pt.LineHeightM - (pt.ElevationM + bulge)
+
+		if i == 0 || i == len(profile)-1 {
+			continue
+		}
+
+		pt.FresnelM = math.Sqrt(wavelength * d1 * d2 / totalM)
+
+		if pt.ClearanceM < a.MinClearanceM {
+			a.MinClearanceM = pt.ClearanceM
+		}
+		if pt.ClearanceM < 0 {
+			a.LineOfSight = false
+			a.ObstructionCount++
+		}
+
+		ratio := pt.ClearanceM / pt.FresnelM
+		if ratio < a.FresnelClearance {
+			a.FresnelClearance = ratio
+			a.WorstObstructionKm = pt.DistanceKm
+		}
+	}
+
+	if math.IsInf(a.MinClearanceM, 1) {
+		a.MinClearanceM = 0
+		a.FresnelClearance = 0
+	}
+	a.FresnelClear = a.FresnelClearance >= 0.6
+	a.Profile = profile
+
+	return a, nil
+}
@@ -0,0 +1,229 @@
+package geocoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+)
+
+var (
+	countryCodePattern     = regexp.MustCompile(`^[A-Z]{2}$`)
+	subdivisionCodePattern = regexp.MustCompile(`^[A-Z]{2}-[A-Z0-9]{1,3}$`)
+)
+
+// Natural Earth (admin_0 / admin_1) and GeoBoundaries (ADM1) property names.
+var (
+	countryCodeProps     = []string{"ISO_A2_EH", "ISO_A2", "iso_a2", "ISO3166-1-Alpha-2"}
+	subdivisionCodeProps = []string{"iso_3166_2", "ISO_3166_2", "shapeISO"}
+	nameProps            = []string{"name", "NAME", "shapeName", "ADMIN", "name_en"}
+)
+
+type boundary struct {
+	code    string
+	country string
+	name    string
+	bound   orb.Bound
+	geom    orb.MultiPolygon
+}
+
+type cellKey struct {
+	lat int
+	lon int
+}
+
+type boundaryIndex struct {
+	countries        []boundary
+	subdivisions     []boundary
+	countryCells     map[cellKey][]int
+	subdivisionCells map[cellKey][]int
+}
+
+type geoJSONCollection struct {
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Properties map[string]any `json:"properties"`
+	Geometry   struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+func loadBoundaryDir(dir string) (*boundaryIndex, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &boundaryIndex{
+		countryCells:     make(map[cellKey][]int),
+		subdivisionCells: make(map[cellKey][]int),
+	}
+
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".geojson" && ext != ".json") {
+			continue
+		}
+		if err := idx.loadFile(filepath.Join(dir, e.Name())); err != nil {
+			return nil, err
+		}
+	}
+
+	if idx.Len() == 0 {
+		return nil, nil
+	}
+
+	return idx, nil
+}
+
+func (idx *boundaryIndex) Len() int {
+	if idx == nil {
+		return 0
+	}
+	return len(idx.countries) + len(idx.subdivisions)
+}
+
+func (idx *boundaryIndex) loadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var fc geoJSONCollection
+	if err := json.Unmarshal(raw, &fc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for _, f := range fc.Features {
+		geom, err := parseGeometry(f.Geometry.Type, f.Geometry.Coordinates)
+		if err != nil {
+			return fmt.Errorf("failed to parse geometry in %s: %w", path, err)
+		}
+		if geom == nil {
+			continue
+		}
+
+		b := boundary{
+			name:  stringProp(f.Properties, nameProps, nil),
+			bound: geom.Bound(),
+			geom:  geom,
+		}
+
+		if code := stringProp(f.Properties, subdivisionCodeProps, subdivisionCodePattern); code != "" {
+			b.code = code
+			b.country = code[:2]
+			idx.subdivisions = append(idx.subdivisions, b)
+			idx.index(idx.subdivisionCells, b.bound, len(idx.subdivisions)-1)
+		} else if code := stringProp(f.Properties, countryCodeProps, countryCodePattern); code != "" {
+			b.code = code
+			b.country = code
+			idx.countries = append(idx.countries, b)
+			idx.index(idx.countryCells, b.bound, len(idx.countries)-1)
+		}
+	}
+
+	return nil
+}
+
+func (idx *boundaryIndex) index(cells map[cellKey][]int, bound orb.Bound, i int) {
+	for lat := int(math.Floor(bound.Min.Lat())); lat <= int(math.Floor(bound.Max.Lat())); lat++ {
+		for lon := int(math.Floor(bound.Min.Lon())); lon <= int(math.Floor(bound.Max.Lon())); lon++ {
+			key := cellKey{lat, lon}
+			cells[key] = append(cells[key], i)
+		}
+	}
+}
+
+func (idx *boundaryIndex) find(list []boundary, cells map[cellKey][]int, lat, lon float64) *boundary {
+	pt := orb.Point{lon, lat}
+	for _, i := range cells[cellKey{int(math.Floor(lat)), int(math.Floor(lon))}] {
+		b := &list[i]
+		if b.bound.Contains(pt) && planar.MultiPolygonContains(b.geom, pt) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (idx *boundaryIndex) country(lat, lon float64) *boundary {
+	return idx.find(idx.countries, idx.countryCells, lat, lon)
+}
+
+func (idx *boundaryIndex) subdivision(lat, lon float64) *boundary {
+	return idx.find(idx.subdivisions, idx.subdivisionCells, lat, lon)
+}
+
+func parseGeometry(kind string, coords json.RawMessage) (orb.MultiPolygon, error) {
+	switch kind {
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(coords, &rings); err != nil {
+			return nil, err
+		}
+		return orb.MultiPolygon{toPolygon(rings)}, nil
+	case "MultiPolygon":
+		var polygons [][][][]float64
+		if err := json.Unmarshal(coords, &polygons); err != nil {
+			return nil, err
+		}
+		mp := make(orb.MultiPolygon, 0, len(polygons))
+		for _, rings := range polygons {
+			mp = append(mp, toPolygon(rings))
+		}
+		return mp, nil
+	}
+	return nil, nil
+}
+
+func toPolygon(rings [][][]float64) orb.Polygon {
+	polygon := make(orb.Polygon, 0, len(rings))
+	for _, ring := range rings {
+		r := make(orb.Ring, 0, len(ring))
+		for _, p := range ring {
+			if len(p) >= 2 {
+				r = append(r, orb.Point{p[0], p[1]})
+			}
+		}
+		polygon = append(polygon, r)
+	}
+	return polygon
+}
+
+func stringProp(props map[string]any, keys []string, pattern *regexp.Regexp) string {
+	for _, k := range keys {
+		v, ok := props[k].(string)
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if pattern != nil {
+			v = strings.ToUpper(v)
+			if !pattern.MatchString(v) {
+				continue
+			}
+		}
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func subdivisionSuffix(code string) string {
+	if i := strings.IndexByte(code, '-'); i >= 0 {
+		return code[i+1:]
+	}
+	return code
+}
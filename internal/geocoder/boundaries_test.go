@@ -0,0 +1,101 @@
+package geocoder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testBoundaries = `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "properties": {"ISO_A2": "BG", "NAME": "Bulgaria"},
+      "geometry": {"type": "Polygon", "coordinates": [[[22, 41], [29, 41], [29, 44], [22, 44], [22, 41]]]}
+    },
+    {
+      "type": "Feature",
+      "properties": {"ISO_A2": "-99", "ISO_A2_EH": "RS", "NAME": "Serbia"},
+      "geometry": {"type": "MultiPolygon", "coordinates": [[[[18, 42], [22, 42], [22, 46], [18, 46], [18, 42]]]]}
+    },
+    {
+      "type": "Feature",
+      "properties": {"iso_3166_2": "BG-22", "name": "Sofia-Grad"},
+      "geometry": {"type": "Polygon", "coordinates": [[[23, 42], [24, 42], [24, 43], [23, 43], [23, 42]]]}
+    }
+  ]
+}`
+
+func newTestGeocoder(t *testing.T) *Geocoder {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "boundaries.geojson"), []byte(testBoundaries), 0o644); err != nil {
+		t.Fatalf("Failed to write boundaries: %v", err)
+	}
+
+	idx, err := loadBoundaryDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to load boundaries: %v", err)
+	}
+
+	return &Geocoder{
+		index: newCityIndex([]city{
+			{geonameID: 727011, name: "Sofia", countryCode: "BG", lat: 42.69751, lon: 23.32415, admin1Code: "42"},
+			{geonameID: 787657, name: "Nis", countryCode: "RS", lat: 43.32472, lon: 21.90333, admin1Code: "SE"},
+			{geonameID: 703448, name: "Kyiv", countryCode: "UA", lat: 50.45466, lon: 30.5238, admin1Code: "12"},
+		}),
+		boundaries: idx,
+	}
+}
+
+func TestLocate(t *testing.T) {
+	g := newTestGeocoder(t)
+
+	tests := []struct {
+		name        string
+		lat, lon    float64
+		country     string
+		subdivision string
+		locality    uint32
+		source      string
+	}{
+		{"Inside subdivision", 42.7, 23.3, "BG", "BG-22", 727011, SourceBoundary},
+		{"Border area nearer to a foreign city", 43.0, 22.1, "BG", "", 727011, SourceBoundary},
+		{"Natural Earth -99 falls back to ISO_A2_EH", 43.3, 21.9, "RS", "", 787657, SourceBoundary},
+		{"Outside boundaries", 50.4, 30.5, "UA", "", 703448, SourceNearestCity},
+		{"Sparse area far from any city", 0, -150, "UA", "", 703448, SourceNearestCity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := g.Locate(tt.lat, tt.lon)
+			if loc.CountryCode != tt.country || loc.SubdivisionCode != tt.subdivision ||
+				loc.LocalityID != tt.locality || loc.Source != tt.source {
+				t.Errorf("Unexpected location %+v", loc)
+			}
+		})
+	}
+}
+
+func TestReverseGeocodeWithBoundaries(t *testing.T) {
+	g := newTestGeocoder(t)
+
+	region, district, country := g.ReverseGeocode(42.7, 23.3)
+	if region != "SOF" || district != "22" || country != "BG" {
+		t.Errorf("Expected SOF/22/BG, got %s/%s/%s", region, district, country)
+	}
+
+	region, district, country = g.ReverseGeocode(43.0, 22.1)
+	if region != "SOF" || district != "42" || country != "BG" {
+		t.Errorf("Expected SOF/42/BG near the border, got %s/%s/%s", region, district, country)
+	}
+}
+
+func TestLoadBoundaryDirMissing(t *testing.T) {
+	idx, err := loadBoundaryDir(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || idx != nil {
+		t.Errorf("Expected nil index without error, got %v, %v", idx, err)
+	}
+}
@@ -1,173 +1,225 @@
 package geocoder
 
 import (
-	"bufio"
 	"math"
-	"os"
-	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type city struct {
+	geonameID   uint32
 	name        string
+	asciiName   string
 	countryCode string
 	lat         float32
 	lon         float32
 	admin1Code  string
+	population  uint32
+	// Normalized alternate names, comma separated, for Search.
+	searchNames string
 }
 
-type gridCell struct {
-	cities []city
-}
+const DefaultMaxDistanceKm = 50.0
 
 type Geocoder struct {
-	grid     map[int]map[int]*gridCell
-	gridSize float64
-	mu       sync.RWMutex
+	opts          Options
+	index         *cityIndex
+	places        *placeIndex
+	boundaries    *boundaryIndex
+	admin1Names   map[string]string
+	countryNames  map[string]string
+	maxDistanceKm float64
+	sources       []string
+	loadedAt      time.Time
+	loadErr       error
+	mu            sync.RWMutex
+	reloadMu      sync.Mutex
 }
 
-var instance *Geocoder
-var once sync.Once
-
-func GetInstance() *Geocoder {
-	once.Do(func() {
-		instance = &Geocoder{
-			grid:     make(map[int]map[int]*gridCell),
-			gridSize: 1.0,
-		}
-		if err := instance.loadCities(); err != nil {
-			panic(err)
-		}
-	})
-	return instance
+// New returns a geocoder for the given sources without loading them; call
+// Reload to load the data. Until a load succeeds the geocoder resolves
+// nothing, so the server can still start when the data is missing.
+func New(opts Options) *Geocoder {
+	return &Geocoder{
+		opts:          opts.withDefaults(),
+		maxDistanceKm: DefaultMaxDistanceKm,
+	}
 }
 
-func (g *Geocoder) getGridKey(lat, lon float64) (int, int) {
-	gridLat := int(math.Floor(lat / g.gridSize))
-	gridLon := int(math.Floor(lon / g.gridSize))
-	return gridLat, gridLon
+func (g *Geocoder) SetMaxDistance(km float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxDistanceKm = km
 }
 
-func (g *Geocoder) loadCities() error {
-	dataPath := "data/cities15000.txt"
-	if _, err := os.Stat(dataPath); os.IsNotExist(err) {
-		dataPath = "../../data/cities15000.txt"
-	}
+type Location struct {
+	CountryCode     string
+	SubdivisionCode string
+	SubdivisionName string
+	LocalityID      uint32
+	Source          string
 
-	file, err := os.Open(dataPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+	RegionCode   string
+	DistrictCode string
+}
 
-	scanner := bufio.NewScanner(file)
+const (
+	SourceBoundary    = "boundary"
+	SourceNearestCity = "nearest_city"
+)
 
-	g.mu.Lock()
-	defer g.mu.Unlock()
+// Locate resolves the country and subdivision by point-in-polygon against the
+// loaded admin boundaries, falling back to the nearest city where no boundary
+// covers the point. LocalityID is the GeoNames ID of the nearest city in the
+// resolved country. RegionCode and DistrictCode are the 3-character codes
+// stored in region_code and district_code.
+func (g *Geocoder) Locate(lat, lon float64) Location {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
+	var loc Location
 
-		fields := strings.Split(line, "\t")
-		if len(fields) < 11 {
-			continue
+	if g.boundaries != nil {
+		if country := g.boundaries.country(lat, lon); country != nil {
+			loc.CountryCode = country.code
+			loc.Source = SourceBoundary
 		}
-
-		lat, err := strconv.ParseFloat(fields[4], 64)
-		if err != nil {
-			continue
+		if sub := g.boundaries.subdivision(lat, lon); sub != nil {
+			loc.SubdivisionCode = sub.code
+			loc.SubdivisionName = sub.name
+			if loc.CountryCode == "" {
+				loc.CountryCode = sub.country
+				loc.Source = SourceBoundary
+			}
 		}
+	}
 
-		lon, err := strconv.ParseFloat(fields[5], 64)
-		if err != nil {
-			continue
+	nearest, _ := g.nearestCity(lat, lon, loc.CountryCode)
+	if nearest != nil {
+		loc.LocalityID = nearest.geonameID
+		if loc.CountryCode == "" {
+			loc.CountryCode = strings.ToUpper(nearest.countryCode)
+			loc.Source = SourceNearestCity
 		}
 
-		c := city{
-			name:        fields[1],
-			countryCode: fields[8],
-			lat:         float32(lat),
-			lon:         float32(lon),
-			admin1Code:  fields[10],
+		loc.RegionCode = truncateCode(nearest.name, 3)
+		if strings.EqualFold(nearest.countryCode, loc.CountryCode) {
+			loc.DistrictCode = truncateCode(nearest.admin1Code, 3)
 		}
+	}
 
-		gridLat, gridLon := g.getGridKey(lat, lon)
+	if loc.SubdivisionCode != "" {
+		loc.DistrictCode = truncateCode(subdivisionSuffix(loc.SubdivisionCode), 3)
+	}
 
-		if g.grid[gridLat] == nil {
-			g.grid[gridLat] = make(map[int]*gridCell)
-		}
-		if g.grid[gridLat][gridLon] == nil {
-			g.grid[gridLat][gridLon] = &gridCell{
-				cities: make([]city, 0, 10),
-			}
-		}
+	return loc
+}
 
-		g.grid[gridLat][gridLon].cities = append(g.grid[gridLat][gridLon].cities, c)
+// nearestCity returns the nearest city within the maximum distance in
+// countryCode, or in any country when countryCode is empty or has no cities.
+func (g *Geocoder) nearestCity(lat, lon float64, countryCode string) (*city, float64) {
+	var filter func(*city) bool
+	if g.index.hasCountry(countryCode) {
+		filter = func(c *city) bool { return strings.EqualFold(c.countryCode, countryCode) }
 	}
 
-	return scanner.Err()
+	found := g.index.Nearest(lat, lon, 1, g.maxDistanceKm, filter)
+	if len(found) == 0 {
+		return nil, 0
+	}
+
+	return found[0].city, found[0].distanceKm
 }
 
-func (g *Geocoder) ReverseGeocode(lat, lon float64) (regionCode, districtCode, countryCode string) {
+type Result struct {
+	Name            string  `json:"name"`
+	ASCIIName       string  `json:"asciiName"`
+	GeonameID       uint32  `json:"geonameId"`
+	CountryCode     string  `json:"countryCode"`
+	CountryName     string  `json:"countryName"`
+	Admin1Code      string  `json:"admin1Code"`
+	Admin1Name      string  `json:"admin1Name"`
+	SubdivisionCode string  `json:"subdivisionCode,omitempty"`
+	Population      uint32  `json:"population"`
+	Lat             float64 `json:"lat"`
+	Lon             float64 `json:"lon"`
+	DistanceKm      float64 `json:"distanceKm"`
+}
+
+// Lookup returns the nearest city to a point, within the configured maximum
+// distance, in the country resolved by Locate.
+func (g *Geocoder) Lookup(lat, lon float64) (Result, bool) {
+	loc := g.Locate(lat, lon)
+
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
-	gridLat, gridLon := g.getGridKey(lat, lon)
+	nearest, dist := g.nearestCity(lat, lon, loc.CountryCode)
+	if nearest == nil {
+		return Result{}, false
+	}
 
-	minDist := math.MaxFloat64
-	var nearestCity *city
+	result := g.result(nearest, dist)
+	result.SubdivisionCode = loc.SubdivisionCode
+	return result, true
+}
 
-	for dLat := -1; dLat <= 1; dLat++ {
-		for dLon := -1; dLon <= 1; dLon++ {
-			checkLat := gridLat + dLat
-			checkLon := gridLon + dLon
+// Nearest returns up to k cities closest to the point, nearest first,
+// regardless of the maximum distance.
+func (g *Geocoder) Nearest(lat, lon float64, k int) []Result {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 
-			if g.grid[checkLat] == nil || g.grid[checkLat][checkLon] == nil {
-				continue
-			}
+	return g.results(g.index.Nearest(lat, lon, k, 0, nil))
+}
 
-			cell := g.grid[checkLat][checkLon]
-			for i := range cell.cities {
-				dist := haversine(lat, lon, float64(cell.cities[i].lat), float64(cell.cities[i].lon))
-				if dist < minDist {
-					minDist = dist
-					nearestCity = &cell.cities[i]
-				}
-			}
-		}
-	}
+// WithinRadius returns every city within km of the point, nearest first.
+func (g *Geocoder) WithinRadius(lat, lon, km float64) []Result {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 
-	if nearestCity == nil {
-		return "", "", ""
-	}
+	return g.results(g.index.WithinRadius(lat, lon, km, nil))
+}
 
-	cityName := nearestCity.name
-	if len(cityName) > 3 {
-		regionCode = cityName[:3]
-	} else {
-		regionCode = cityName
+func (g *Geocoder) results(found []neighbor) []Result {
+	results := make([]Result, len(found))
+	for i, n := range found {
+		results[i] = g.result(n.city, n.distanceKm)
 	}
+	return results
+}
 
-	districtCode = nearestCity.admin1Code
-	if len(districtCode) > 3 {
-		districtCode = districtCode[:3]
+func (g *Geocoder) result(c *city, dist float64) Result {
+	countryCode := strings.ToUpper(c.countryCode)
+	return Result{
+		Name:        c.name,
+		ASCIIName:   c.asciiName,
+		GeonameID:   c.geonameID,
+		CountryCode: countryCode,
+		CountryName: g.countryNames[countryCode],
+		Admin1Code:  c.admin1Code,
+		Admin1Name:  g.admin1Names[countryCode+"."+c.admin1Code],
+		Population:  c.population,
+		Lat:         float64(c.lat),
+		Lon:         float64(c.lon),
+		DistanceKm:  dist,
 	}
+}
 
-	countryCode = nearestCity.countryCode
-	if len(countryCode) > 2 {
-		countryCode = countryCode[:2]
-	}
+func (g *Geocoder) ReverseGeocode(lat, lon float64) (regionCode, districtCode, countryCode string) {
+	loc := g.Locate(lat, lon)
+	return loc.RegionCode, loc.DistrictCode, truncateCode(loc.CountryCode, 2)
+}
 
-	return strings.ToUpper(regionCode), strings.ToUpper(districtCode), strings.ToUpper(countryCode)
+func truncateCode(s string, n int) string {
+	if len(s) > n {
+		s = s[:n]
+	}
+	return strings.ToUpper(s)
 }
 
 func haversine(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371
-
 	dLat := (lat2 - lat1) * math.Pi / 180.0
 	dLon := (lon2 - lon1) * math.Pi / 180.0
 
@@ -178,5 +230,5 @@ func haversine(lat1, lon1, lat2, lon2 float64) float64 {
 		math.Sin(dLon/2)*math.Sin(dLon/2)*math.Cos(lat1)*math.Cos(lat2)
 	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
 
-	return R * c
+	return earthRadiusKm * c
 }
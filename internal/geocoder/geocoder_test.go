@@ -10,7 +10,10 @@ func TestMemoryUsage(t *testing.T) {
 	runtime.GC()
 	runtime.ReadMemStats(&m1)
 
-	geo := GetInstance()
+	geo := New(DefaultOptions())
+	if err := geo.Reload(); err != nil {
+		t.Fatalf("Failed to load geocoding data: %v", err)
+	}
 
 	runtime.GC()
 	runtime.ReadMemStats(&m2)
@@ -18,21 +21,14 @@ func TestMemoryUsage(t *testing.T) {
 	allocatedMB := float64(m2.Alloc-m1.Alloc) / 1024 / 1024
 
 	t.Logf("Memory used by geocoder: %.2f MB", allocatedMB)
-	t.Logf("Grid cells: %d", countGridCells(geo))
-}
-
-func countGridCells(g *Geocoder) int {
-	count := 0
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	for _, lonMap := range g.grid {
-		count += len(lonMap)
-	}
-	return count
+	t.Logf("Indexed cities: %d", geo.index.Len())
 }
 
 func TestReverseGeocode(t *testing.T) {
-	geo := GetInstance()
+	geo := New(DefaultOptions())
+	if err := geo.Reload(); err != nil {
+		t.Fatalf("Failed to load geocoding data: %v", err)
+	}
 
 	tests := []struct {
 		name string
@@ -55,3 +51,31 @@ func TestReverseGeocode(t *testing.T) {
 		})
 	}
 }
+
+func TestLookup(t *testing.T) {
+	g := newTestGeocoder(t)
+	g.admin1Names = map[string]string{"BG.42": "Sofia-Capital"}
+	g.countryNames = map[string]string{"BG": "Bulgaria"}
+	g.SetMaxDistance(DefaultMaxDistanceKm)
+
+	result, ok := g.Lookup(42.7, 23.3)
+	if !ok {
+		t.Fatalf("Expected a result near Sofia")
+	}
+	if result.Name != "Sofia" || result.GeonameID != 727011 || result.CountryName != "Bulgaria" ||
+		result.Admin1Name != "Sofia-Capital" || result.SubdivisionCode != "BG-22" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if result.DistanceKm <= 0 || result.DistanceKm > 5 {
+		t.Errorf("Expected distance under 5 km, got %.2f", result.DistanceKm)
+	}
+
+	if _, ok := g.Lookup(43.0, 22.1); ok {
+		t.Errorf("Expected no result beyond the %.0f km cutoff", DefaultMaxDistanceKm)
+	}
+
+	region, _, country := g.ReverseGeocode(43.0, 22.1)
+	if region != "" || country != "BG" {
+		t.Errorf("Expected country from boundary without a city, got %s/%s", region, country)
+	}
+}
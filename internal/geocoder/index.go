@@ -0,0 +1,242 @@
+package geocoder
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const earthRadiusKm = 6371.0
+
+// cityIndex is a static k-d tree over cities projected onto the unit sphere.
+// Euclidean (chord) distance in 3D is monotonic with great-circle distance,
+// so nearest neighbour and radius searches are exact everywhere, including
+// across the antimeridian and near the poles, with no cell size to tune.
+//
+// The tree is implicit: for a range [lo, hi) the node is at mid = (lo+hi)/2,
+// with the left subtree in [lo, mid) and the right one in [mid+1, hi).
+type cityIndex struct {
+	cities    []city
+	points    [][3]float64
+	countries map[string]bool
+}
+
+type neighbor struct {
+	city       *city
+	distanceKm float64
+}
+
+func newCityIndex(cities []city) *cityIndex {
+	points := make([][3]float64, len(cities))
+	for i := range cities {
+		points[i] = toUnitVector(float64(cities[i].lat), float64(cities[i].lon))
+	}
+
+	order := make([]int, len(cities))
+	for i := range order {
+		order[i] = i
+	}
+	buildTree(order, points, 0)
+
+	ordered := make([]city, len(cities))
+	for i, j := range order {
+		ordered[i] = cities[j]
+	}
+	return indexTreeOrdered(ordered)
+}
+
+// indexTreeOrdered wraps cities that are already in tree order, as stored in
+// a snapshot.
+func indexTreeOrdered(cities []city) *cityIndex {
+	idx := &cityIndex{
+		cities:    cities,
+		points:    make([][3]float64, len(cities)),
+		countries: make(map[string]bool),
+	}
+	for i := range cities {
+		idx.points[i] = toUnitVector(float64(cities[i].lat), float64(cities[i].lon))
+		idx.countries[strings.ToUpper(cities[i].countryCode)] = true
+	}
+	return idx
+}
+
+func buildTree(order []int, points [][3]float64, depth int) {
+	if len(order) <= 1 {
+		return
+	}
+
+	axis := depth % 3
+	sort.Slice(order, func(i, j int) bool {
+		return points[order[i]][axis] < points[order[j]][axis]
+	})
+
+	mid := len(order) / 2
+	buildTree(order[:mid], points, depth+1)
+	buildTree(order[mid+1:], points, depth+1)
+}
+
+func (idx *cityIndex) Len() int {
+	if idx == nil {
+		return 0
+	}
+	return len(idx.cities)
+}
+
+func (idx *cityIndex) hasCountry(countryCode string) bool {
+	return idx != nil && idx.countries[strings.ToUpper(countryCode)]
+}
+
+// Nearest returns up to k cities closest to the point, nearest first. Cities
+// rejected by filter are skipped; maxKm limits the search when positive.
+func (idx *cityIndex) Nearest(lat, lon float64, k int, maxKm float64, filter func(*city) bool) []neighbor {
+	if k <= 0 {
+		return nil
+	}
+	return idx.search(lat, lon, k, maxKm, filter)
+}
+
+// WithinRadius returns every city within km of the point, nearest first.
+func (idx *cityIndex) WithinRadius(lat, lon, km float64, filter func(*city) bool) []neighbor {
+	if km <= 0 {
+		return nil
+	}
+	return idx.search(lat, lon, 0, km, filter)
+}
+
+func (idx *cityIndex) search(lat, lon float64, k int, maxKm float64, filter func(*city) bool) []neighbor {
+	if idx.Len() == 0 {
+		return nil
+	}
+
+	s := searcher{
+		idx:    idx,
+		q:      toUnitVector(lat, lon),
+		k:      k,
+		bound:  math.Inf(1),
+		filter: filter,
+		found:  make(candidates, 0, max(k+1, 8)),
+	}
+	if maxKm > 0 {
+		chord := chordLength(maxKm)
+		s.bound = chord * chord
+	}
+	s.visit(0, len(idx.cities), 0)
+
+	sort.Slice(s.found, func(i, j int) bool { return s.found[i].dist2 < s.found[j].dist2 })
+	result := make([]neighbor, len(s.found))
+	for i, c := range s.found {
+		nearest := &idx.cities[c.i]
+		result[i] = neighbor{
+			city:       nearest,
+			distanceKm: haversine(lat, lon, float64(nearest.lat), float64(nearest.lon)),
+		}
+	}
+	return result
+}
+
+type candidate struct {
+	i     int
+	dist2 float64
+}
+
+// candidates is a max-heap on squared chord distance, so the worst of the
+// current k best is at the top. It is sifted by hand rather than through
+// container/heap to keep the search free of allocations.
+type candidates []candidate
+
+func (c *candidates) push(x candidate) {
+	*c = append(*c, x)
+	h := *c
+	for i := len(h) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if h[parent].dist2 >= h[i].dist2 {
+			break
+		}
+		h[parent], h[i] = h[i], h[parent]
+		i = parent
+	}
+}
+
+func (c *candidates) popWorst() {
+	h := *c
+	last := len(h) - 1
+	h[0] = h[last]
+	h = h[:last]
+	for i := 0; ; {
+		largest, left, right := i, 2*i+1, 2*i+2
+		if left < len(h) && h[left].dist2 > h[largest].dist2 {
+			largest = left
+		}
+		if right < len(h) && h[right].dist2 > h[largest].dist2 {
+			largest = right
+		}
+		if largest == i {
+			break
+		}
+		h[i], h[largest] = h[largest], h[i]
+		i = largest
+	}
+	*c = h
+}
+
+type searcher struct {
+	idx    *cityIndex
+	q      [3]float64
+	k      int
+	bound  float64
+	filter func(*city) bool
+	found  candidates
+}
+
+func (s *searcher) visit(lo, hi, depth int) {
+	if lo >= hi {
+		return
+	}
+
+	mid := (lo + hi) / 2
+	p := s.idx.points[mid]
+
+	if d2 := squaredDistance(s.q, p); d2 <= s.bound && (s.filter == nil || s.filter(&s.idx.cities[mid])) {
+		s.found.push(candidate{i: mid, dist2: d2})
+		if s.k > 0 && len(s.found) > s.k {
+			s.found.popWorst()
+		}
+		if s.k > 0 && len(s.found) == s.k {
+			s.bound = s.found[0].dist2
+		}
+	}
+
+	axis := depth % 3
+	diff := s.q[axis] - p[axis]
+	if diff < 0 {
+		s.visit(lo, mid, depth+1)
+		if diff*diff <= s.bound {
+			s.visit(mid+1, hi, depth+1)
+		}
+	} else {
+		s.visit(mid+1, hi, depth+1)
+		if diff*diff <= s.bound {
+			s.visit(lo, mid, depth+1)
+		}
+	}
+}
+
+func toUnitVector(lat, lon float64) [3]float64 {
+	latRad := lat * math.Pi / 180
+	lonRad := lon * math.Pi / 180
+	return [3]float64{
+		math.Cos(latRad) * math.Cos(lonRad),
+		math.Cos(latRad) * math.Sin(lonRad),
+		math.Sin(latRad),
+	}
+}
+
+func chordLength(km float64) float64 {
+	angle := math.Min(km/earthRadiusKm, math.Pi)
+	return 2 * math.Sin(angle/2)
+}
+
+func squaredDistance(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
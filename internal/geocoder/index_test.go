@@ -0,0 +1,257 @@
+package geocoder
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomCities(n int, seed int64) []city {
+	r := rand.New(rand.NewSource(seed))
+	cities := make([]city, n)
+	for i := range cities {
+		// Uniform on the sphere, so the poles are not oversampled.
+		lat := math.Asin(2*r.Float64()-1) * 180 / math.Pi
+		lon := r.Float64()*360 - 180
+		cities[i] = city{geonameID: uint32(i + 1), countryCode: "XX", lat: float32(lat), lon: float32(lon)}
+	}
+	return cities
+}
+
+func bruteForceNearest(cities []city, lat, lon float64, k int) []uint32 {
+	type hit struct {
+		id   uint32
+		dist float64
+	}
+	hits := make([]hit, 0, k+1)
+	for _, c := range cities {
+		d := haversine(lat, lon, float64(c.lat), float64(c.lon))
+		i := len(hits)
+		for i > 0 && hits[i-1].dist > d {
+			i--
+		}
+		if i < k {
+			hits = append(hits, hit{})
+			copy(hits[i+1:], hits[i:])
+			hits[i] = hit{c.geonameID, d}
+			if len(hits) > k {
+				hits = hits[:k]
+			}
+		}
+	}
+
+	ids := make([]uint32, len(hits))
+	for i, h := range hits {
+		ids[i] = h.id
+	}
+	return ids
+}
+
+func TestIndexNearestMatchesBruteForce(t *testing.T) {
+	cities := randomCities(2000, 1)
+	idx := newCityIndex(cities)
+
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		lat := r.Float64()*180 - 90
+		lon := r.Float64()*360 - 180
+
+		want := bruteForceNearest(cities, lat, lon, 5)
+		got := idx.Nearest(lat, lon, 5, 0, nil)
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d neighbors, got %d", len(want), len(got))
+		}
+		for j := range got {
+			if got[j].city.geonameID != want[j] {
+				t.Fatalf("Query %.3f,%.3f: neighbor %d is %d, want %d", lat, lon, j, got[j].city.geonameID, want[j])
+			}
+		}
+	}
+}
+
+func TestIndexAntimeridianAndPoles(t *testing.T) {
+	idx := newCityIndex([]city{
+		{geonameID: 1, name: "Suva", lat: -18.14, lon: 178.44},
+		{geonameID: 2, name: "Apia", lat: -13.83, lon: -171.76},
+		{geonameID: 3, name: "Taveuni", lat: -16.8, lon: 179.97},
+		{geonameID: 4, name: "Longyearbyen", lat: 78.22, lon: 15.64},
+	})
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     uint32
+	}{
+		{"East of the antimeridian", -16.8, -179.9, 3},
+		{"West of the antimeridian", -18, 179.5, 1},
+		{"Near the north pole", 89.9, -170, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := idx.Nearest(tt.lat, tt.lon, 1, 0, nil)
+			if len(found) != 1 || found[0].city.geonameID != tt.want {
+				t.Errorf("Expected city %d, got %+v", tt.want, found)
+			}
+		})
+	}
+
+	within := idx.WithinRadius(-16.8, -179.9, 300, nil)
+	if len(within) != 2 || within[0].city.geonameID != 3 || within[1].city.geonameID != 1 {
+		t.Errorf("Expected Taveuni then Suva within 300 km across the antimeridian, got %d cities", len(within))
+	}
+	for _, n := range within {
+		if n.distanceKm > 300 {
+			t.Errorf("%s is %.0f km away, beyond the radius", n.city.name, n.distanceKm)
+		}
+	}
+}
+
+func TestIndexNearestMaxDistanceAndFilter(t *testing.T) {
+	idx := newCityIndex([]city{
+		{geonameID: 1, countryCode: "BG", lat: 42.69751, lon: 23.32415},
+		{geonameID: 2, countryCode: "RS", lat: 43.32472, lon: 21.90333},
+	})
+
+	if found := idx.Nearest(43.0, 22.1, 1, 50, nil); len(found) != 1 || found[0].city.geonameID != 2 {
+		t.Errorf("Expected Nis within 50 km, got %+v", found)
+	}
+
+	onlyBG := func(c *city) bool { return c.countryCode == "BG" }
+	if found := idx.Nearest(43.0, 22.1, 1, 50, onlyBG); len(found) != 0 {
+		t.Errorf("Expected no Bulgarian city within 50 km, got %+v", found)
+	}
+	if found := idx.Nearest(43.0, 22.1, 1, 0, onlyBG); len(found) != 1 || found[0].city.geonameID != 1 {
+		t.Errorf("Expected Sofia without a distance limit, got %+v", found)
+	}
+	if !idx.hasCountry("bg") || idx.hasCountry("UA") {
+		t.Errorf("Unexpected country set %v", idx.countries)
+	}
+}
+
+func TestIndexSparseArea(t *testing.T) {
+	cities := []city{{geonameID: 1, lat: 64.14, lon: -21.94}}
+	idx := newCityIndex(cities)
+	legacy := newLegacyGrid(cities)
+
+	// Over 3° from the only city: the old grid only looked at neighbouring
+	// 1° cells and found nothing.
+	if c := legacy.nearest(68, -16); c != nil {
+		t.Fatalf("Expected the legacy grid to miss, got %+v", c)
+	}
+	if found := idx.Nearest(68, -16, 1, 0, nil); len(found) != 1 {
+		t.Errorf("Expected the index to find the only city")
+	}
+}
+
+// legacyGrid is the fixed 1° grid the index replaced, kept for comparison.
+type legacyGrid struct {
+	cells map[int]map[int][]city
+}
+
+func newLegacyGrid(cities []city) *legacyGrid {
+	g := &legacyGrid{cells: make(map[int]map[int][]city)}
+	for _, c := range cities {
+		lat, lon := int(math.Floor(float64(c.lat))), int(math.Floor(float64(c.lon)))
+		if g.cells[lat] == nil {
+			g.cells[lat] = make(map[int][]city)
+		}
+		g.cells[lat][lon] = append(g.cells[lat][lon], c)
+	}
+	return g
+}
+
+func (g *legacyGrid) nearest(lat, lon float64) *city {
+	gridLat, gridLon := int(math.Floor(lat)), int(math.Floor(lon))
+
+	minDist := math.MaxFloat64
+	var nearest *city
+	for dLat := -1; dLat <= 1; dLat++ {
+		for dLon := -1; dLon <= 1; dLon++ {
+			cell := g.cells[gridLat+dLat][gridLon+dLon]
+			for i := range cell {
+				if d := haversine(lat, lon, float64(cell[i].lat), float64(cell[i].lon)); d < minDist {
+					minDist = d
+					nearest = &cell[i]
+				}
+			}
+		}
+	}
+	return nearest
+}
+
+// About the size of cities15000.
+const benchmarkCities = 30000
+
+func benchmarkQueries(n int) [][2]float64 {
+	r := rand.New(rand.NewSource(3))
+	queries := make([][2]float64, n)
+	for i := range queries {
+		queries[i] = [2]float64{r.Float64()*140 - 60, r.Float64()*360 - 180}
+	}
+	return queries
+}
+
+func BenchmarkLegacyGridNearest(b *testing.B) {
+	g := newLegacyGrid(randomCities(benchmarkCities, 1))
+	queries := benchmarkQueries(1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := queries[i%len(queries)]
+		g.nearest(q[0], q[1])
+	}
+}
+
+func BenchmarkIndexNearest(b *testing.B) {
+	idx := newCityIndex(randomCities(benchmarkCities, 1))
+	queries := benchmarkQueries(1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := queries[i%len(queries)]
+		idx.Nearest(q[0], q[1], 1, 0, nil)
+	}
+}
+
+func BenchmarkIndexNearestWithinCutoff(b *testing.B) {
+	idx := newCityIndex(randomCities(benchmarkCities, 1))
+	queries := benchmarkQueries(1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := queries[i%len(queries)]
+		idx.Nearest(q[0], q[1], 1, DefaultMaxDistanceKm, nil)
+	}
+}
+
+func BenchmarkIndexNearest10(b *testing.B) {
+	idx := newCityIndex(randomCities(benchmarkCities, 1))
+	queries := benchmarkQueries(1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := queries[i%len(queries)]
+		idx.Nearest(q[0], q[1], 10, 0, nil)
+	}
+}
+
+func BenchmarkIndexWithinRadius(b *testing.B) {
+	idx := newCityIndex(randomCities(benchmarkCities, 1))
+	queries := benchmarkQueries(1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := queries[i%len(queries)]
+		idx.WithinRadius(q[0], q[1], 100, nil)
+	}
+}
+
+func BenchmarkBuildIndex(b *testing.B) {
+	cities := randomCities(benchmarkCities, 1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newCityIndex(cities)
+	}
+}
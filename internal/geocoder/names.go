@@ -0,0 +1,39 @@
+package geocoder
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// loadNameFile reads a GeoNames tab separated file into a code -> name map.
+// Missing files are not an error; names are optional.
+func loadNameFile(path string, keyField, nameField int) (map[string]string, error) {
+	names := make(map[string]string)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) <= keyField || len(fields) <= nameField {
+			continue
+		}
+
+		names[fields[keyField]] = fields[nameField]
+	}
+
+	return names, scanner.Err()
+}
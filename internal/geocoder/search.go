@@ -0,0 +1,262 @@
+package geocoder
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// cyrillicToLatin follows the Bulgarian streamlined system GeoNames uses for
+// Bulgarian ASCII names, plus the Serbian, Macedonian, Ukrainian and Russian
+// letters it lacks.
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n",
+	'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f",
+	'х': "h", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sht", 'ъ': "a", 'ь': "y",
+	'ю': "yu", 'я': "ya",
+	'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+	'ѓ': "gj", 'ѕ': "dz", 'ќ': "kj",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g",
+	'ё': "e", 'ы': "y", 'э': "e",
+}
+
+// Latin letters without a canonical decomposition.
+var latinFolds = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ł': "l", 'ı': "i",
+	'þ': "th", 'ð': "d", 'ħ': "h",
+}
+
+// normalizeName folds a place name to lowercase ASCII words separated by
+// single spaces: diacritics are stripped and Cyrillic is transliterated, so
+// "Niš" and "Nis" both normalize to "nis" and "Пловдив" to "plovdiv". Names
+// in other scripts normalize to "".
+func normalizeName(s string) string {
+	var b strings.Builder
+	space := false
+	write := func(w string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(w)
+	}
+
+	for _, r := range strings.ToLower(s) {
+		// Before decomposing, which would turn й into и and a breve.
+		if w, ok := cyrillicToLatin[r]; ok {
+			write(w)
+			continue
+		}
+		if w, ok := latinFolds[r]; ok {
+			write(w)
+			continue
+		}
+
+		for _, d := range norm.NFD.String(string(r)) {
+			switch {
+			case unicode.Is(unicode.Mn, d):
+			case d < unicode.MaxASCII && (unicode.IsLetter(d) || unicode.IsDigit(d)):
+				write(string(d))
+			case unicode.IsLetter(d):
+				return ""
+			default:
+				space = true
+			}
+		}
+	}
+	return b.String()
+}
+
+// searchNames joins the distinct normalized alternate names of a place that
+// differ from its name, for the place index.
+func searchNames(name, asciiName, alternates string) string {
+	seen := map[string]bool{normalizeName(name): true, normalizeName(asciiName): true}
+
+	var names []string
+	for _, alt := range strings.Split(alternates, ",") {
+		key := normalizeName(alt)
+		if len(key) < 2 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, key)
+	}
+	return strings.Join(names, ",")
+}
+
+type placeEntry struct {
+	key  string
+	city int32
+	// Whether key starts at the beginning of the name rather than at a
+	// later word.
+	start bool
+}
+
+// placeIndex is a sorted list of every word suffix of every normalized name,
+// so a prefix search matches the start of any word: "tarn" finds
+// "Veliko Tarnovo".
+type placeIndex struct {
+	entries []placeEntry
+}
+
+func newPlaceIndex(cities []city) *placeIndex {
+	idx := &placeIndex{}
+
+	for i := range cities {
+		c := &cities[i]
+		names := []string{normalizeName(c.name), normalizeName(c.asciiName)}
+		if c.searchNames != "" {
+			names = append(names, strings.Split(c.searchNames, ",")...)
+		}
+
+		seen := make(map[string]bool)
+		for _, name := range names {
+			for start := 0; start < len(name); {
+				key := name[start:]
+				if !seen[key] {
+					seen[key] = true
+					idx.entries = append(idx.entries, placeEntry{key: key, city: int32(i), start: start == 0})
+				}
+				next := strings.IndexByte(key, ' ')
+				if next < 0 {
+					break
+				}
+				start += next + 1
+			}
+		}
+	}
+
+	sort.Slice(idx.entries, func(i, j int) bool { return idx.entries[i].key < idx.entries[j].key })
+	return idx
+}
+
+type placeMatch struct {
+	city *city
+	rank int
+}
+
+// search returns up to limit cities with a name or word starting with the
+// normalized query, exact names first, then names starting with the query,
+// then other words, most populous first within each group.
+func (idx *placeIndex) search(cities []city, query string, limit int, filter func(*city) bool) []placeMatch {
+	query = normalizeName(query)
+	if idx == nil || query == "" || limit <= 0 {
+		return nil
+	}
+
+	first := sort.Search(len(idx.entries), func(i int) bool { return idx.entries[i].key >= query })
+
+	best := make(map[int32]int)
+	for _, e := range idx.entries[first:] {
+		if !strings.HasPrefix(e.key, query) {
+			break
+		}
+		if filter != nil && !filter(&cities[e.city]) {
+			continue
+		}
+
+		rank := 2
+		if e.start && e.key == query {
+			rank = 0
+		} else if e.start {
+			rank = 1
+		}
+		if r, ok := best[e.city]; !ok || rank < r {
+			best[e.city] = rank
+		}
+	}
+
+	matches := make([]placeMatch, 0, len(best))
+	for i, rank := range best {
+		matches = append(matches, placeMatch{city: &cities[i], rank: rank})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		if matches[i].city.population != matches[j].city.population {
+			return matches[i].city.population > matches[j].city.population
+		}
+		return matches[i].city.geonameID < matches[j].city.geonameID
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+type Place struct {
+	Name            string     `json:"name"`
+	ASCIIName       string     `json:"asciiName"`
+	GeonameID       uint32     `json:"geonameId"`
+	CountryCode     string     `json:"countryCode"`
+	CountryName     string     `json:"countryName"`
+	Admin1Code      string     `json:"admin1Code"`
+	Admin1Name      string     `json:"admin1Name"`
+	SubdivisionCode string     `json:"subdivisionCode,omitempty"`
+	Population      uint32     `json:"population"`
+	Lat             float64    `json:"lat"`
+	Lon             float64    `json:"lon"`
+	BBox            [4]float64 `json:"bbox"`
+}
+
+// Search finds places by name. Matching is by prefix of any word and
+// ignores case, diacritics and Cyrillic/Latin script, over names, ASCII
+// names and alternate names. countryCode, when set, limits the results to
+// one country.
+func (g *Geocoder) Search(query, countryCode string, limit int) []Place {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.index == nil {
+		return nil
+	}
+
+	var filter func(*city) bool
+	if countryCode != "" {
+		filter = func(c *city) bool { return strings.EqualFold(c.countryCode, countryCode) }
+	}
+
+	matches := g.places.search(g.index.cities, query, limit, filter)
+	places := make([]Place, len(matches))
+	for i, m := range matches {
+		r := g.result(m.city, 0)
+		places[i] = Place{
+			Name:            r.Name,
+			ASCIIName:       r.ASCIIName,
+			GeonameID:       r.GeonameID,
+			CountryCode:     r.CountryCode,
+			CountryName:     r.CountryName,
+			Admin1Code:      r.Admin1Code,
+			Admin1Name:      r.Admin1Name,
+			SubdivisionCode: r.SubdivisionCode,
+			Population:      r.Population,
+			Lat:             r.Lat,
+			Lon:             r.Lon,
+			BBox:            placeBBox(r.Lat, r.Lon, r.Population),
+		}
+	}
+	return places
+}
+
+// placeBBox approximates the extent of a place, which GeoNames doesn't
+// provide, from its population: about 3 km across for a village, 20 km for a
+// city of a million. It is [minLon, minLat, maxLon, maxLat] as in GeoJSON.
+func placeBBox(lat, lon float64, population uint32) [4]float64 {
+	radiusKm := 1 + 0.01*math.Sqrt(float64(population))
+
+	dLat := radiusKm / (math.Pi * earthRadiusKm / 180)
+	dLon := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+
+	return [4]float64{
+		lon - dLon,
+		math.Max(lat-dLat, -90),
+		lon + dLon,
+		math.Min(lat+dLat, 90),
+	}
+}
@@ -0,0 +1,96 @@
+package geocoder
+
+import (
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Niš", "nis"},
+		{"Ниш", "nish"},
+		{"Sofia", "sofia"},
+		{"София", "sofiya"},
+		{"Велико Търново", "veliko tarnovo"},
+		{"Veliko Tarnovo", "veliko tarnovo"},
+		{"Благоевград", "blagoevgrad"},
+		{"Пловдив", "plovdiv"},
+		{"Свети Влас", "sveti vlas"},
+		{"Київ", "kiyiv"},
+		{"Ђевђелија", "djevdjelija"},
+		{"Kraków", "krakow"},
+		{"Łódź", "lodz"},
+		{"Straße", "strasse"},
+		{"  Saint-Étienne ", "saint etienne"},
+		{"東京", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeName(tt.in); got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func newSearchGeocoder() *Geocoder {
+	cities := []city{
+		{geonameID: 727011, name: "Sofia", asciiName: "Sofia", countryCode: "BG", lat: 42.69751, lon: 23.32415, population: 1152556,
+			searchNames: searchNames("Sofia", "Sofia", "SOF,Serdica,Sofija,София,Софія")},
+		{geonameID: 725712, name: "Veliko Tarnovo", asciiName: "Veliko Tarnovo", countryCode: "BG", lat: 43.08124, lon: 25.62904, population: 68783,
+			searchNames: searchNames("Veliko Tarnovo", "Veliko Tarnovo", "Велико Търново,Tirnovo")},
+		{geonameID: 787657, name: "Niš", asciiName: "Nis", countryCode: "RS", lat: 43.32472, lon: 21.90333, population: 250000,
+			searchNames: searchNames("Niš", "Nis", "Ниш,Naissus")},
+		{geonameID: 1, name: "Sofievka", asciiName: "Sofievka", countryCode: "UA", lat: 48.07, lon: 33.88, population: 8000},
+	}
+
+	g := &Geocoder{index: newCityIndex(cities)}
+	g.places = newPlaceIndex(g.index.cities)
+	return g
+}
+
+func TestSearch(t *testing.T) {
+	g := newSearchGeocoder()
+
+	tests := []struct {
+		name    string
+		query   string
+		country string
+		want    []uint32
+	}{
+		{"Exact name", "Sofia", "", []uint32{727011}},
+		{"Prefix, most populous first", "sof", "", []uint32{727011, 1}},
+		{"Cyrillic query", "Соф", "", []uint32{727011, 1}},
+		{"Cyrillic alternate name", "София", "", []uint32{727011}},
+		{"Without diacritics", "nis", "", []uint32{787657}},
+		{"Latin query for Cyrillic name", "Nish", "", []uint32{787657}},
+		{"Later word", "tarn", "", []uint32{725712}},
+		{"Alternate name", "serdica", "", []uint32{727011}},
+		{"Country filter", "sof", "ua", []uint32{1}},
+		{"No match", "xyz", "", nil},
+		{"Other script", "東京", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			places := g.Search(tt.query, tt.country, 10)
+			if len(places) != len(tt.want) {
+				t.Fatalf("Expected %d places, got %+v", len(tt.want), places)
+			}
+			for i, p := range places {
+				if p.GeonameID != tt.want[i] {
+					t.Errorf("Place %d is %d (%s), want %d", i, p.GeonameID, p.Name, tt.want[i])
+				}
+			}
+		})
+	}
+
+	places := g.Search("sof", "", 1)
+	if len(places) != 1 {
+		t.Fatalf("Expected the limit to apply, got %d places", len(places))
+	}
+	bbox := places[0].BBox
+	if !(bbox[0] < places[0].Lon && places[0].Lon < bbox[2] && bbox[1] < places[0].Lat && places[0].Lat < bbox[3]) {
+		t.Errorf("Expected the bounding box %v to contain the place", bbox)
+	}
+}
@@ -0,0 +1,278 @@
+package geocoder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+)
+
+// A snapshot holds the cities (already in k-d tree order) and the admin1 and
+// country names, so loading is a few array decodes instead of parsing the
+// GeoNames dumps and rebuilding the index.
+//
+// Layout, little endian:
+//
+//	magic "MCGEO" version(uint8)
+//	strings: count(uint32) offsets(uint32 x count+1) bytes
+//	cities: count(uint32), then one column at a time:
+//	  geonameID(uint32) lat(float32) lon(float32) population(uint32)
+//	  name asciiName countryCode admin1Code searchNames (uint32 string refs)
+//	admin1 names, country names: count(uint32) (key, name string refs)
+//	crc32(uint32) of everything before it
+//
+// Every string is stored once and referenced by index.
+const (
+	snapshotMagic   = "MCGEO"
+	snapshotVersion = 2
+)
+
+var ErrInvalidSnapshot = errors.New("invalid geocoder snapshot")
+
+type snapshotData struct {
+	index        *cityIndex
+	admin1Names  map[string]string
+	countryNames map[string]string
+}
+
+// BuildSnapshot loads the GeoNames files selected by opts and writes them to
+// w as a snapshot. It returns the number of cities written.
+func BuildSnapshot(opts Options, w io.Writer) (int, error) {
+	data, err := loadSources(opts.withDefaults())
+	if err != nil {
+		return 0, err
+	}
+
+	if err := writeSnapshot(w, data); err != nil {
+		return 0, err
+	}
+	return data.index.Len(), nil
+}
+
+func writeSnapshot(w io.Writer, data *snapshotData) error {
+	interned := make(map[string]uint32)
+	var table []string
+	ref := func(s string) uint32 {
+		if i, ok := interned[s]; ok {
+			return i
+		}
+		i := uint32(len(table))
+		interned[s] = i
+		table = append(table, s)
+		return i
+	}
+
+	cities := data.index.cities
+	refs := make([][5]uint32, len(cities))
+	for i, c := range cities {
+		refs[i] = [5]uint32{ref(c.name), ref(c.asciiName), ref(c.countryCode), ref(c.admin1Code), ref(c.searchNames)}
+	}
+	admin1 := namePairs(data.admin1Names, ref)
+	countries := namePairs(data.countryNames, ref)
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	put := func(v uint32) {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], v)
+		bw.Write(b[:])
+	}
+
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+
+	put(uint32(len(table)))
+	var offset uint32
+	for _, s := range table {
+		put(offset)
+		offset += uint32(len(s))
+	}
+	put(offset)
+	for _, s := range table {
+		bw.WriteString(s)
+	}
+
+	put(uint32(len(cities)))
+	for _, c := range cities {
+		put(c.geonameID)
+	}
+	for _, c := range cities {
+		put(math.Float32bits(c.lat))
+	}
+	for _, c := range cities {
+		put(math.Float32bits(c.lon))
+	}
+	for _, c := range cities {
+		put(c.population)
+	}
+	for field := range 5 {
+		for _, r := range refs {
+			put(r[field])
+		}
+	}
+
+	for _, pairs := range [][][2]uint32{admin1, countries} {
+		put(uint32(len(pairs)))
+		for _, p := range pairs {
+			put(p[0])
+			put(p[1])
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc.Sum32())
+	_, err := w.Write(sum[:])
+	return err
+}
+
+func namePairs(names map[string]string, ref func(string) uint32) [][2]uint32 {
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([][2]uint32, len(keys))
+	for i, k := range keys {
+		pairs[i] = [2]uint32{ref(k), ref(names[k])}
+	}
+	return pairs
+}
+
+type snapshotReader struct {
+	b   []byte
+	err error
+}
+
+func (r *snapshotReader) uint32() uint32 {
+	if r.err != nil || len(r.b) < 4 {
+		r.err = ErrInvalidSnapshot
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *snapshotReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		r.err = ErrInvalidSnapshot
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// count reads an element count and checks that many elements of size bytes
+// are left, so a corrupt count can't cause a huge allocation.
+func (r *snapshotReader) count(size int) int {
+	n := int(r.uint32())
+	if r.err == nil && n*size > len(r.b) {
+		r.err = ErrInvalidSnapshot
+	}
+	if r.err != nil {
+		return 0
+	}
+	return n
+}
+
+func readSnapshot(b []byte) (*snapshotData, error) {
+	header := len(snapshotMagic) + 1
+	if len(b) < header+4 || string(b[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrInvalidSnapshot
+	}
+	if b[len(snapshotMagic)] != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, b[len(snapshotMagic)])
+	}
+
+	body := b[:len(b)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(b[len(b)-4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+
+	r := &snapshotReader{b: body[header:]}
+
+	stringCount := r.count(4)
+	offsets := make([]uint32, stringCount+1)
+	for i := range offsets {
+		offsets[i] = r.uint32()
+	}
+	// One allocation for all strings; each entry is a substring of it.
+	all := string(r.bytes(int(offsets[stringCount])))
+	table := make([]string, stringCount)
+	for i := range table {
+		if offsets[i] > offsets[i+1] || int(offsets[i+1]) > len(all) {
+			return nil, ErrInvalidSnapshot
+		}
+		table[i] = all[offsets[i]:offsets[i+1]]
+	}
+	str := func() string {
+		i := r.uint32()
+		if int(i) >= len(table) {
+			r.err = ErrInvalidSnapshot
+			return ""
+		}
+		return table[i]
+	}
+
+	cities := make([]city, r.count(9*4))
+	for i := range cities {
+		cities[i].geonameID = r.uint32()
+	}
+	for i := range cities {
+		cities[i].lat = math.Float32frombits(r.uint32())
+	}
+	for i := range cities {
+		cities[i].lon = math.Float32frombits(r.uint32())
+	}
+	for i := range cities {
+		cities[i].population = r.uint32()
+	}
+	for i := range cities {
+		cities[i].name = str()
+	}
+	for i := range cities {
+		cities[i].asciiName = str()
+	}
+	for i := range cities {
+		cities[i].countryCode = str()
+	}
+	for i := range cities {
+		cities[i].admin1Code = str()
+	}
+	for i := range cities {
+		cities[i].searchNames = str()
+	}
+
+	names := make([]map[string]string, 2)
+	for i := range names {
+		n := r.count(8)
+		names[i] = make(map[string]string, n)
+		for j := 0; j < n; j++ {
+			k := str()
+			names[i][k] = str()
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.b) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidSnapshot)
+	}
+
+	return &snapshotData{
+		index:        indexTreeOrdered(cities),
+		admin1Names:  names[0],
+		countryNames: names[1],
+	}, nil
+}
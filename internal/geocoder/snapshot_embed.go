@@ -0,0 +1,11 @@
+//go:build geocoder_embed
+
+package geocoder
+
+import _ "embed"
+
+// Built with -tags geocoder_embed after writing the snapshot next to this
+// file, e.g. go run ./cmd/geocoder-snapshot -o internal/geocoder/geocoder.snap
+//
+//go:embed geocoder.snap
+var embeddedSnapshot []byte
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package geocoder
+
+import "os"
+
+func loadSnapshotFile(path string) (*snapshotData, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return readSnapshot(b)
+}
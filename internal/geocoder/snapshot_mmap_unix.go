@@ -0,0 +1,34 @@
+//go:build unix
+
+package geocoder
+
+import (
+	"os"
+	"syscall"
+)
+
+// loadSnapshotFile maps the snapshot into memory rather than reading it, so
+// the decode runs straight off the page cache.
+func loadSnapshotFile(path string) (*snapshotData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, ErrInvalidSnapshot
+	}
+
+	b, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Munmap(b)
+
+	return readSnapshot(b)
+}
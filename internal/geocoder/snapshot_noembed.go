@@ -0,0 +1,5 @@
+//go:build !geocoder_embed
+
+package geocoder
+
+var embeddedSnapshot []byte
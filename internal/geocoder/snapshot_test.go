@@ -0,0 +1,140 @@
+package geocoder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cities15000.txt"), []byte(testCities), 0o644); err != nil {
+		t.Fatalf("Failed to write cities: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "countryInfo.txt"), []byte("BG\tBGR\t100\tBU\tBulgaria\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write country names: %v", err)
+	}
+
+	var buf bytes.Buffer
+	count, err := BuildSnapshot(Options{DataDir: dir}, &buf)
+	if err != nil {
+		t.Fatalf("BuildSnapshot failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 cities, got %d", count)
+	}
+
+	data, err := readSnapshot(buf.Bytes())
+	if err != nil {
+		t.Fatalf("readSnapshot failed: %v", err)
+	}
+
+	source, err := loadSources(Options{DataDir: dir}.withDefaults())
+	if err != nil {
+		t.Fatalf("loadSources failed: %v", err)
+	}
+	if fmt.Sprint(data.index.cities) != fmt.Sprint(source.index.cities) {
+		t.Errorf("Cities differ after round trip:\n%v\n%v", data.index.cities, source.index.cities)
+	}
+	if data.countryNames["BG"] != "Bulgaria" {
+		t.Errorf("Expected country names in the snapshot, got %v", data.countryNames)
+	}
+
+	// The snapshot takes precedence over the city files once written.
+	if err := os.WriteFile(filepath.Join(dir, DefaultSnapshotFile), buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "cities15000.txt")); err != nil {
+		t.Fatalf("Failed to remove cities: %v", err)
+	}
+
+	g := New(Options{DataDir: dir})
+	if err := g.Reload(); err != nil {
+		t.Fatalf("Reload from snapshot failed: %v", err)
+	}
+	if result, ok := g.Lookup(43.3, 21.9); !ok || result.Name != "Niš" || result.GeonameID != 787657 {
+		t.Errorf("Unexpected lookup from snapshot %+v", result)
+	}
+	if status := g.Status(); len(status.Sources) != 1 || status.Sources[0] != filepath.Join(dir, DefaultSnapshotFile) {
+		t.Errorf("Expected the snapshot as the source, got %v", status.Sources)
+	}
+
+	// Configured city files win over a snapshot left in the data directory.
+	local := "727011\tСофия\tSofiya\t\t42.69751\t23.32415\tP\tPPLC\tBG\t\t42\t\t\t\t1152556\n"
+	if err := os.WriteFile(filepath.Join(dir, "local.txt"), []byte(local), 0o644); err != nil {
+		t.Fatalf("Failed to write cities: %v", err)
+	}
+	g = New(Options{DataDir: dir, Cities: []string{"local.txt"}})
+	if err := g.Reload(); err != nil {
+		t.Fatalf("Reload from configured cities failed: %v", err)
+	}
+	if status := g.Status(); len(status.Sources) != 1 || status.Sources[0] != "local.txt" {
+		t.Errorf("Expected the configured cities as the source, got %v", status.Sources)
+	}
+	if result, ok := g.Lookup(42.7, 23.3); !ok || result.Name != "София" {
+		t.Errorf("Expected the configured name for Sofia, got %+v", result)
+	}
+}
+
+func TestReadSnapshotInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSnapshot(&buf, &snapshotData{index: newCityIndex(randomCities(100, 1))}); err != nil {
+		t.Fatalf("writeSnapshot failed: %v", err)
+	}
+	valid := buf.Bytes()
+
+	corrupt := bytes.Clone(valid)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"Empty", nil},
+		{"Wrong magic", append([]byte("NOPE!"), valid[5:]...)},
+		{"Truncated", valid[:len(valid)/2]},
+		{"Corrupt", corrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readSnapshot(tt.data); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Errorf("Expected ErrInvalidSnapshot, got %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkParseCities(b *testing.B) {
+	var tsv bytes.Buffer
+	for _, c := range randomCities(benchmarkCities, 1) {
+		fmt.Fprintf(&tsv, "%d\tPlace %d\tPlace %d\t\t%f\t%f\tP\tPPL\t%s\t\t01\t\t\t\t%d\t\t\t\tEurope/Sofia\t2024-01-01\n",
+			c.geonameID, c.geonameID, c.geonameID, c.lat, c.lon, c.countryCode, c.geonameID)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cities, err := parseCities(bytes.NewReader(tsv.Bytes()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		newCityIndex(cities)
+	}
+}
+
+func BenchmarkReadSnapshot(b *testing.B) {
+	var buf bytes.Buffer
+	if err := writeSnapshot(&buf, &snapshotData{index: newCityIndex(randomCities(benchmarkCities, 1))}); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := readSnapshot(buf.Bytes()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
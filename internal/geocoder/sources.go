@@ -0,0 +1,318 @@
+package geocoder
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCitiesFile   = "cities15000.txt"
+	DefaultSnapshotFile = "geocoder.snap"
+)
+
+// Options selects the data the geocoder loads. Relative paths are resolved
+// against DataDir.
+type Options struct {
+	DataDir string
+
+	// Cities lists GeoNames dump files (e.g. cities500.txt, cities1000.zip),
+	// loaded in order. Rows with a GeoNames ID already loaded replace the
+	// earlier row, so a supplemental file in the same tab separated layout
+	// can rename places or add local ones.
+	Cities []string
+
+	// Snapshot is a file written by BuildSnapshot. Unless Cities was set, it
+	// is loaded instead of the city and name files when it exists, and a
+	// snapshot embedded at build time otherwise.
+	Snapshot string
+
+	BoundariesDir string
+
+	defaultCities bool
+}
+
+func DefaultOptions() Options {
+	return Options{}.withDefaults()
+}
+
+func (o Options) withDefaults() Options {
+	if o.DataDir == "" {
+		o.DataDir = "data"
+		if _, err := os.Stat(o.DataDir); os.IsNotExist(err) {
+			o.DataDir = "../../data"
+		}
+	}
+	if len(o.Cities) == 0 {
+		o.Cities = []string{DefaultCitiesFile}
+		o.defaultCities = true
+	}
+	if o.Snapshot == "" {
+		o.Snapshot = DefaultSnapshotFile
+	}
+	if o.BoundariesDir == "" {
+		o.BoundariesDir = "boundaries"
+	}
+	return o
+}
+
+func (o Options) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(o.DataDir, name)
+}
+
+type Status struct {
+	Ready      bool       `json:"ready"`
+	Cities     int        `json:"cities"`
+	Boundaries int        `json:"boundaries"`
+	Sources    []string   `json:"sources"`
+	LoadedAt   *time.Time `json:"loadedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Ready reports whether city data has been loaded.
+func (g *Geocoder) Ready() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.index.Len() > 0
+}
+
+func (g *Geocoder) Status() Status {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	status := Status{
+		Ready:      g.index.Len() > 0,
+		Cities:     g.index.Len(),
+		Boundaries: g.boundaries.Len(),
+		Sources:    g.sources,
+	}
+	if !g.loadedAt.IsZero() {
+		loadedAt := g.loadedAt
+		status.LoadedAt = &loadedAt
+	}
+	if g.loadErr != nil {
+		status.Error = g.loadErr.Error()
+	}
+	return status
+}
+
+// Reload loads every source and swaps the new data in atomically. On error
+// the data already loaded, if any, stays in use.
+func (g *Geocoder) Reload() error {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	data, sources, err := loadData(g.opts)
+	var boundaries *boundaryIndex
+	var places *placeIndex
+	if err == nil {
+		places = newPlaceIndex(data.index.cities)
+		boundaries, err = loadBoundaryDir(g.opts.path(g.opts.BoundariesDir))
+		if err != nil {
+			err = fmt.Errorf("failed to load boundaries: %w", err)
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.loadErr = err
+	if err != nil {
+		return err
+	}
+
+	g.index = data.index
+	g.places = places
+	g.boundaries = boundaries
+	g.admin1Names = data.admin1Names
+	g.countryNames = data.countryNames
+	g.sources = sources
+	g.loadedAt = time.Now()
+
+	return nil
+}
+
+// loadData loads the snapshot file if there is one, then the embedded
+// snapshot, and falls back to the GeoNames files. Configured city files
+// always win over both snapshots, which may have been built from others.
+func loadData(opts Options) (*snapshotData, []string, error) {
+	path := opts.path(opts.Snapshot)
+	if _, err := os.Stat(path); err == nil && opts.defaultCities {
+		data, err := loadSnapshotFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load snapshot %s: %w", path, err)
+		}
+		return data, []string{path}, nil
+	}
+
+	if embeddedSnapshot != nil && opts.defaultCities {
+		data, err := readSnapshot(embeddedSnapshot)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load embedded snapshot: %w", err)
+		}
+		return data, []string{"embedded"}, nil
+	}
+
+	data, err := loadSources(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, opts.Cities, nil
+}
+
+func loadSources(opts Options) (*snapshotData, error) {
+	var cities []city
+	seen := make(map[uint32]int)
+
+	for _, name := range opts.Cities {
+		loaded, err := loadCityFile(opts.path(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", name, err)
+		}
+
+		for _, c := range loaded {
+			if i, ok := seen[c.geonameID]; ok && c.geonameID != 0 {
+				cities[i] = c
+				continue
+			}
+			seen[c.geonameID] = len(cities)
+			cities = append(cities, c)
+		}
+	}
+	if len(cities) == 0 {
+		return nil, errors.New("no cities loaded")
+	}
+
+	admin1, err := loadNameFile(opts.path("admin1CodesASCII.txt"), 0, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin1 names: %w", err)
+	}
+
+	countries, err := loadNameFile(opts.path("countryInfo.txt"), 0, 4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load country names: %w", err)
+	}
+
+	return &snapshotData{
+		index:        newCityIndex(cities),
+		admin1Names:  admin1,
+		countryNames: countries,
+	}, nil
+}
+
+// loadCityFile reads a GeoNames dump, either plain or zipped as published.
+// A missing .txt file is looked up as .zip as well.
+func loadCityFile(path string) ([]city, error) {
+	if strings.EqualFold(filepath.Ext(path), ".txt") {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			zipped := strings.TrimSuffix(path, filepath.Ext(path)) + ".zip"
+			if _, err := os.Stat(zipped); err == nil {
+				path = zipped
+			}
+		}
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return loadCityZip(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseCities(file)
+}
+
+func loadCityZip(path string) ([]city, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	want := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".txt"
+
+	var entry *zip.File
+	for _, f := range archive.File {
+		if f.Name == want {
+			entry = f
+			break
+		}
+		if entry == nil && strings.EqualFold(filepath.Ext(f.Name), ".txt") && !strings.EqualFold(f.Name, "readme.txt") {
+			entry = f
+		}
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("no .txt file in %s", path)
+	}
+
+	r, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return parseCities(r)
+}
+
+func parseCities(r io.Reader) ([]city, error) {
+	scanner := bufio.NewScanner(r)
+	// The alternatenames column of larger places runs past the default limit.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var cities []city
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 11 {
+			continue
+		}
+
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			continue
+		}
+
+		lon, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			continue
+		}
+
+		geonameID, _ := strconv.ParseUint(fields[0], 10, 32)
+
+		var population uint64
+		if len(fields) > 14 {
+			population, _ = strconv.ParseUint(fields[14], 10, 32)
+		}
+
+		cities = append(cities, city{
+			geonameID:   uint32(geonameID),
+			name:        fields[1],
+			asciiName:   fields[2],
+			population:  uint32(population),
+			countryCode: fields[8],
+			lat:         float32(lat),
+			lon:         float32(lon),
+			admin1Code:  fields[10],
+			searchNames: searchNames(fields[1], fields[2], fields[3]),
+		})
+	}
+
+	return cities, scanner.Err()
+}
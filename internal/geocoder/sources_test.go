@@ -0,0 +1,107 @@
+package geocoder
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCities = "727011\tSofia\tSofia\t\t42.69751\t23.32415\tP\tPPLC\tBG\t\t42\t\t\t\t1152556\n" +
+	"787657\tNiš\tNis\t\t43.32472\t21.90333\tP\tPPLA\tRS\t\tSE\t\t\t\t250000\n"
+
+func writeCityZip(t *testing.T, path, entry, content string) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create zip: %v", err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	f, err := w.Create(entry)
+	if err != nil {
+		t.Fatalf("Failed to add zip entry: %v", err)
+	}
+	if _, err := f.Write([]byte(content)); err != nil {
+		t.Fatalf("Failed to write zip entry: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+}
+
+func TestReloadFromZipWithSupplemental(t *testing.T) {
+	dir := t.TempDir()
+	writeCityZip(t, filepath.Join(dir, "cities15000.zip"), "cities15000.txt", testCities)
+
+	// Renames Sofia and adds a village GeoNames doesn't list.
+	local := "727011\tСофия\tSofiya\t\t42.69751\t23.32415\tP\tPPLC\tBG\t\t42\t\t\t\t1152556\n" +
+		"0\tBistritsa\tBistritsa\t\t42.5833\t23.3667\tP\tPPL\tBG\t\t42\t\t\t\t2000\n"
+	if err := os.WriteFile(filepath.Join(dir, "local.txt"), []byte(local), 0o644); err != nil {
+		t.Fatalf("Failed to write supplemental file: %v", err)
+	}
+
+	g := New(Options{DataDir: dir, Cities: []string{"cities15000.txt", "local.txt"}})
+	if g.Ready() {
+		t.Fatalf("Expected geocoder not to be ready before Reload")
+	}
+	if err := g.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	status := g.Status()
+	if !status.Ready || status.Cities != 3 || status.LoadedAt == nil || status.Error != "" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	if result, ok := g.Lookup(42.7, 23.3); !ok || result.Name != "София" {
+		t.Errorf("Expected the supplemental name for Sofia, got %+v", result)
+	}
+	if result, ok := g.Lookup(42.58, 23.37); !ok || result.Name != "Bistritsa" {
+		t.Errorf("Expected the supplemental village, got %+v", result)
+	}
+}
+
+func TestReloadFailureKeepsData(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cities.txt")
+	if err := os.WriteFile(path, []byte(testCities), 0o644); err != nil {
+		t.Fatalf("Failed to write cities: %v", err)
+	}
+
+	g := New(Options{DataDir: dir, Cities: []string{"cities.txt"}})
+	if err := g.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove cities: %v", err)
+	}
+	if err := g.Reload(); err == nil {
+		t.Fatalf("Expected an error for a missing cities file")
+	}
+
+	status := g.Status()
+	if !status.Ready || status.Cities != 2 || status.Error == "" {
+		t.Errorf("Expected the earlier data to stay loaded with the error reported, got %+v", status)
+	}
+}
+
+func TestDegradedWithoutData(t *testing.T) {
+	g := New(Options{DataDir: t.TempDir()})
+	if err := g.Reload(); err == nil {
+		t.Fatalf("Expected an error without data")
+	}
+
+	if g.Ready() {
+		t.Errorf("Expected geocoder not to be ready")
+	}
+	if loc := g.Locate(42.7, 23.3); loc != (Location{}) {
+		t.Errorf("Expected an empty location, got %+v", loc)
+	}
+	if _, ok := g.Lookup(42.7, 23.3); ok {
+		t.Errorf("Expected no lookup result")
+	}
+}
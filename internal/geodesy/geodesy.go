@@ -0,0 +1,71 @@
+package geodesy
+
+import "math"
+
+const EarthRadiusKm = 6371.0
+
+func toRad(deg float64) float64 {
+	return deg * math.Pi / 180.0
+}
+
+func toDeg(rad float64) float64 {
+	return rad * 180.0 / math.Pi
+}
+
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Sin(dLon/2)*math.Sin(dLon/2)*math.Cos(toRad(lat1))*math.Cos(toRad(lat2))
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return EarthRadiusKm * c
+}
+
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := toRad(lat1)
+	phi2 := toRad(lat2)
+	dLon := toRad(lon2 - lon1)
+
+	y := math.Sin(dLon) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLon)
+
+	return math.Mod(toDeg(math.Atan2(y, x))+360, 360)
+}
+
+func Destination(lat, lon, bearing, distanceKm float64) (float64, float64) {
+	delta := distanceKm / EarthRadiusKm
+	theta := toRad(bearing)
+	phi1 := toRad(lat)
+	lambda1 := toRad(lon)
+
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1),
+		math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+
+	return toDeg(phi2), NormalizeLon(toDeg(lambda2))
+}
+
+func NormalizeLon(lon float64) float64 {
+	return math.Mod(math.Mod(lon+180, 360)+360, 360) - 180
+}
+
+func Interpolate(lat1, lon1, lat2, lon2, f float64) (float64, float64) {
+	d := Distance(lat1, lon1, lat2, lon2) / EarthRadiusKm
+	if d == 0 {
+		return lat1, lon1
+	}
+
+	phi1, lambda1 := toRad(lat1), toRad(lon1)
+	phi2, lambda2 := toRad(lat2), toRad(lon2)
+
+	a := math.Sin((1-f)*d) / math.Sin(d)
+	b := math.Sin(f*d) / math.Sin(d)
+
+	x := a*math.Cos(phi1)*math.Cos(lambda1) + b*math.Cos(phi2)*math.Cos(lambda2)
+	y := a*math.Cos(phi1)*math.Sin(lambda1) + b*math.Cos(phi2)*math.Sin(lambda2)
+	z := a*math.Sin(phi1) + b*math.Sin(phi2)
+
+	return toDeg(math.Atan2(z, math.Sqrt(x*x+y*y))), toDeg(math.Atan2(y, x))
+}
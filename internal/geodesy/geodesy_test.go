@@ -0,0 +1,49 @@
+package geodesy
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	// Sofia -> Plovdiv, roughly 130 km
+	d := Distance(42.6977, 23.3219, 42.1354, 24.7453)
+	if d < 125 || d > 135 {
+		t.Errorf("Expected ~130 km, got %.2f", d)
+	}
+
+	if d := Distance(42.0, 23.0, 42.0, 23.0); d != 0 {
+		t.Errorf("Expected zero distance for identical points, got %f", d)
+	}
+}
+
+func TestDestinationRoundTrip(t *testing.T) {
+	lat, lon := Destination(42.6977, 23.3219, 45, 10)
+	d := Distance(42.6977, 23.3219, lat, lon)
+	if math.Abs(d-10) > 0.01 {
+		t.Errorf("Expected 10 km, got %.4f", d)
+	}
+
+	b := Bearing(42.6977, 23.3219, lat, lon)
+	if math.Abs(b-45) > 0.1 {
+		t.Errorf("Expected bearing 45, got %.4f", b)
+	}
+}
+
+func TestNormalizeLon(t *testing.T) {
+	tests := []struct {
+		in, out float64
+	}{
+		{0, 0},
+		{179, 179},
+		{181, -179},
+		{-181, 179},
+		{540, -180},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeLon(tt.in); math.Abs(got-tt.out) > 1e-9 {
+			t.Errorf("NormalizeLon(%f) = %f, expected %f", tt.in, got, tt.out)
+		}
+	}
+}
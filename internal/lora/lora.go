@@ -0,0 +1,126 @@
+package lora
+
+import (
+	"fmt"
+	"math"
+)
+
+const DefaultNoiseFigure = 6.0
+
+// Demodulator SNR floor per spreading factor (Semtech SX126x/SX127x datasheets).
+var snrLimits = map[int]float64{
+	5:  -2.5,
+	6:  -5.0,
+	7:  -7.5,
+	8:  -10.0,
+	9:  -12.5,
+	10: -15.0,
+	11: -17.5,
+	12: -20.0,
+}
+
+func SNRLimit(sf int) (float64, error) {
+	limit, ok := snrLimits[sf]
+	if !ok {
+		return 0, fmt.Errorf("unsupported spreading factor: %d", sf)
+	}
+	return limit, nil
+}
+
+// Sensitivity returns the receiver sensitivity in dBm for the given spreading
+// factor and bandwidth (kHz): -174 + 10*log10(BW) + NF + SNR limit.
+func Sensitivity(sf int, bwKHz, noiseFigure float64) (float64, error) {
+	if bwKHz <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth: %g", bwKHz)
+	}
+
+	limit, err := SNRLimit(sf)
+	if err != nil {
+		return 0, err
+	}
+
+	return -174 + 10*math.Log10(bwKHz*1000) + noiseFigure + limit, nil
+}
+
+const DefaultPreambleLength = 8
+
+// NormalizeCodingRate accepts either the 4/x denominator used by MeshCore
+// (5-8) or the raw CR index (1-4) and returns the index.
+func NormalizeCodingRate(cr int) (int, error) {
+	switch {
+	case cr >= 1 && cr <= 4:
+		return cr, nil
+	case cr >= 5 && cr <= 8:
+		return cr - 4, nil
+	}
+	return 0, fmt.Errorf("unsupported coding rate: %d", cr)
+}
+
+type AirtimeParams struct {
+	SF             int
+	BWKHz          float64
+	CR             int
+	PreambleLength int
+	ExplicitHeader bool
+	CRC            bool
+}
+
+type Airtime struct {
+	PayloadBytes   int     `json:"payloadBytes"`
+	Symbols        float64 `json:"symbols"`
+	SymbolTimeMs   float64 `json:"symbolTimeMs"`
+	PreambleMs     float64 `json:"preambleMs"`
+	PayloadMs      float64 `json:"payloadMs"`
+	TotalMs        float64 `json:"totalMs"`
+	LowDataRateOpt bool    `json:"lowDataRateOptimize"`
+}
+
+// TimeOnAir follows the Semtech AN1200.13 formula. Low data rate
+// optimization is enabled when the symbol time exceeds 16 ms, as the
+// radio drivers do.
+func TimeOnAir(payloadBytes int, p AirtimeParams) (Airtime, error) {
+	if p.SF < 5 || p.SF > 12 {
+		return Airtime{}, fmt.Errorf("unsupported spreading factor: %d", p.SF)
+	}
+	if p.BWKHz <= 0 {
+		return Airtime{}, fmt.Errorf("invalid bandwidth: %g", p.BWKHz)
+	}
+	cr, err := NormalizeCodingRate(p.CR)
+	if err != nil {
+		return Airtime{}, err
+	}
+	if p.PreambleLength == 0 {
+		p.PreambleLength = DefaultPreambleLength
+	}
+
+	tSym := math.Pow(2, float64(p.SF)) / (p.BWKHz * 1000) * 1000
+	lowDR := tSym > 16
+
+	de, ih, crc := 0.0, 0.0, 0.0
+	if lowDR {
+		de = 1
+	}
+	if !p.ExplicitHeader {
+		ih = 1
+	}
+	if p.CRC {
+		crc = 1
+	}
+
+	num := 8*float64(payloadBytes) - 4*float64(p.SF) + 28 + 16*crc - 20*ih
+	den := 4 * (float64(p.SF) - 2*de)
+	payloadSymbols := 8 + math.Max(math.Ceil(num/den)*float64(cr+4), 0)
+
+	preamble := (float64(p.PreambleLength) + 4.25) * tSym
+	payload := payloadSymbols * tSym
+
+	return Airtime{
+		PayloadBytes:   payloadBytes,
+		Symbols:        float64(p.PreambleLength) + 4.25 + payloadSymbols,
+		SymbolTimeMs:   tSym,
+		PreambleMs:     preamble,
+		PayloadMs:      payload,
+		TotalMs:        preamble + payload,
+		LowDataRateOpt: lowDR,
+	}, nil
+}
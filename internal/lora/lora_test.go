@@ -0,0 +1,103 @@
+package lora
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSensitivity(t *testing.T) {
+	tests := []struct {
+		name     string
+		sf       int
+		bw       float64
+		expected float64
+	}{
+		{"SF7 125kHz", 7, 125, -124.5},
+		{"SF12 125kHz", 12, 125, -137.0},
+		{"SF8 62.5kHz", 8, 62.5, -130.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sensitivity(tt.sf, tt.bw, DefaultNoiseFigure)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if math.Abs(got-tt.expected) > 0.1 {
+				t.Errorf("Expected %.1f dBm, got %.2f dBm", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSensitivityInvalid(t *testing.T) {
+	if _, err := Sensitivity(13, 125, DefaultNoiseFigure); err == nil {
+		t.Errorf("Expected error for SF13")
+	}
+	if _, err := Sensitivity(7, 0, DefaultNoiseFigure); err == nil {
+		t.Errorf("Expected error for zero bandwidth")
+	}
+}
+
+func TestNormalizeCodingRate(t *testing.T) {
+	tests := []struct {
+		in, out int
+		valid   bool
+	}{
+		{1, 1, true},
+		{4, 4, true},
+		{5, 1, true},
+		{8, 4, true},
+		{0, 0, false},
+		{9, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeCodingRate(tt.in)
+		if tt.valid && (err != nil || got != tt.out) {
+			t.Errorf("NormalizeCodingRate(%d) = %d, %v, expected %d", tt.in, got, err, tt.out)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Expected error for coding rate %d", tt.in)
+		}
+	}
+}
+
+func TestTimeOnAir(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  int
+		params   AirtimeParams
+		expected float64
+		lowDR    bool
+	}{
+		{
+			name:     "SF7 125kHz 4/5 20 bytes",
+			payload:  20,
+			params:   AirtimeParams{SF: 7, BWKHz: 125, CR: 5, ExplicitHeader: true, CRC: true},
+			expected: 56.58,
+		},
+		{
+			name:     "SF12 125kHz 4/5 20 bytes",
+			payload:  20,
+			params:   AirtimeParams{SF: 12, BWKHz: 125, CR: 5, ExplicitHeader: true, CRC: true},
+			expected: 1318.91,
+			lowDR:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TimeOnAir(tt.payload, tt.params)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if math.Abs(got.TotalMs-tt.expected) > 0.1 {
+				t.Errorf("Expected %.2f ms, got %.2f ms", tt.expected, got.TotalMs)
+			}
+			if got.LowDataRateOpt != tt.lowDR {
+				t.Errorf("Expected low data rate optimize %v", tt.lowDR)
+			}
+		})
+	}
+}
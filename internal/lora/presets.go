@@ -0,0 +1,72 @@
+package lora
+
+import "math"
+
+const CustomPreset = "custom"
+
+const freqToleranceMHz = 0.002
+
+type Preset struct {
+	ID   string  `json:"id"`
+	Name string  `json:"name"`
+	Freq float64 `json:"freq"`
+	BW   float64 `json:"bw"`
+	SF   int     `json:"sf"`
+	CR   int     `json:"cr"`
+}
+
+// Presets are the regional radio settings offered by the MeshCore apps.
+// Coding rates use the 4/x denominator, as reporters send them.
+var Presets = []Preset{
+	{ID: "eu_uk_narrow", Name: "EU/UK (Narrow)", Freq: 869.618, BW: 62.5, SF: 8, CR: 8},
+	{ID: "eu_uk_long_range", Name: "EU/UK (Long Range)", Freq: 869.525, BW: 250, SF: 11, CR: 5},
+	{ID: "eu_uk_medium_range", Name: "EU/UK (Medium Range)", Freq: 869.525, BW: 250, SF: 10, CR: 5},
+	{ID: "czech_narrow", Name: "Czech Republic (Narrow)", Freq: 869.432, BW: 62.5, SF: 7, CR: 5},
+	{ID: "eu_433_long_range", Name: "EU 433MHz (Long Range)", Freq: 433.650, BW: 250, SF: 11, CR: 5},
+	{ID: "portugal_433", Name: "Portugal 433", Freq: 433.375, BW: 62.5, SF: 9, CR: 6},
+	{ID: "portugal_868", Name: "Portugal 868", Freq: 869.618, BW: 62.5, SF: 7, CR: 6},
+	{ID: "usa_canada", Name: "USA/Canada (Recommended)", Freq: 910.525, BW: 62.5, SF: 7, CR: 5},
+	{ID: "australia", Name: "Australia", Freq: 915.800, BW: 250, SF: 10, CR: 5},
+	{ID: "australia_narrow", Name: "Australia (Narrow)", Freq: 916.575, BW: 62.5, SF: 7, CR: 8},
+	{ID: "new_zealand", Name: "New Zealand", Freq: 917.375, BW: 250, SF: 11, CR: 5},
+	{ID: "new_zealand_narrow", Name: "New Zealand (Narrow)", Freq: 917.375, BW: 62.5, SF: 7, CR: 5},
+	{ID: "vietnam", Name: "Vietnam", Freq: 920.250, BW: 250, SF: 11, CR: 5},
+}
+
+func FindPreset(id string) (Preset, bool) {
+	for _, p := range Presets {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+func IsKnownPreset(id string) bool {
+	if id == CustomPreset {
+		return true
+	}
+	_, ok := FindPreset(id)
+	return ok
+}
+
+// Classify returns the ID of the preset matching the radio settings, or
+// CustomPreset when none does.
+func Classify(freq, bw float64, sf, cr int) string {
+	crIndex, err := NormalizeCodingRate(cr)
+	if err != nil {
+		return CustomPreset
+	}
+
+	for _, p := range Presets {
+		presetCR, _ := NormalizeCodingRate(p.CR)
+		if math.Abs(p.Freq-freq) <= freqToleranceMHz &&
+			math.Abs(p.BW-bw) < 0.01 &&
+			p.SF == sf &&
+			presetCR == crIndex {
+			return p.ID
+		}
+	}
+
+	return CustomPreset
+}
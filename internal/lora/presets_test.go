@@ -0,0 +1,49 @@
+package lora
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		freq     float64
+		bw       float64
+		sf       int
+		cr       int
+		expected string
+	}{
+		{"EU narrow", 869.618, 62.5, 8, 8, "eu_uk_narrow"},
+		{"EU narrow stored as Float32", float64(float32(869.618)), 62.5, 8, 8, "eu_uk_narrow"},
+		{"EU narrow with CR index", 869.618, 62.5, 8, 4, "eu_uk_narrow"},
+		{"Portugal differs only by SF and CR", 869.618, 62.5, 7, 6, "portugal_868"},
+		{"USA", 910.525, 62.5, 7, 5, "usa_canada"},
+		{"Wrong SF", 869.618, 62.5, 9, 8, CustomPreset},
+		{"Off frequency", 869.7, 62.5, 8, 8, CustomPreset},
+		{"Invalid CR", 869.618, 62.5, 8, 0, CustomPreset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.freq, tt.bw, tt.sf, tt.cr); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPresetsAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, p := range Presets {
+		if seen[p.ID] {
+			t.Errorf("Duplicate preset ID %s", p.ID)
+		}
+		seen[p.ID] = true
+
+		if got := Classify(p.Freq, p.BW, p.SF, p.CR); got != p.ID {
+			t.Errorf("Preset %s classifies as %s", p.ID, got)
+		}
+	}
+
+	if !IsKnownPreset(CustomPreset) || IsKnownPreset("unknown") {
+		t.Errorf("Unexpected IsKnownPreset result")
+	}
+}
@@ -0,0 +1,139 @@
+// Package privacy reduces the precision of reported positions according to a
+// reporter's preferences before they are stored.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+
+	"github.com/mmcloughlin/geohash"
+
+	"meshcore-map-api/internal/geodesy"
+)
+
+const (
+	ModeExact   = "exact"
+	ModeGeohash = "geohash"
+	ModeFuzz    = "fuzz"
+
+	HomeDrop    = "drop"
+	HomeCoarsen = "coarsen"
+
+	// MaxPrecision is the geohash precision stored for exact positions by
+	// default, about 38 m x 19 m.
+	MaxPrecision = 8
+
+	DefaultPrecision = 6
+	DefaultFuzzM     = 500.0
+
+	// HomeCoarsePrecision is used for points coarsened inside a home zone,
+	// about 4.9 km x 4.9 km.
+	HomeCoarsePrecision = 5
+
+	// Fuzz offsets are keyed by the cell of this precision (about 153 m)
+	// around the true position, so repeated reports from one spot get the
+	// same offset and can't be averaged back to it.
+	fuzzCellPrecision = 7
+)
+
+// Home is a zone around a reporter's home. Points inside it are dropped or
+// coarsened to HomeCoarsePrecision.
+type Home struct {
+	Lat     float64
+	Lon     float64
+	RadiusM float64
+	Action  string
+}
+
+type Policy struct {
+	Mode string
+	// Precision is the geohash precision kept in ModeGeohash.
+	Precision int
+	// FuzzM is the radius of the random offset in ModeFuzz.
+	FuzzM float64
+	Home  *Home
+
+	// Key and Subject seed fuzz offsets. Without a secret key anyone who
+	// knows the subject could recompute the offset.
+	Key     []byte
+	Subject string
+
+	// GeohashPrecision is the geohash precision stored with exact and fuzzed
+	// positions, and the most kept in ModeGeohash. Zero means MaxPrecision.
+	GeohashPrecision int
+}
+
+// Position is what may be stored of a point. When Precise is false only the
+// geohash may be stored; Lat and Lon are then its centre, for geocoding.
+type Position struct {
+	Lat     float64
+	Lon     float64
+	Geohash string
+	Precise bool
+}
+
+// Apply returns the position to store for a point, or false when the point
+// must not be stored at all.
+func (p Policy) Apply(lat, lon float64) (Position, bool) {
+	mode, precision := p.Mode, p.Precision
+	if mode == "" {
+		mode = ModeExact
+	}
+	if precision <= 0 || precision > MaxPrecision {
+		precision = DefaultPrecision
+	}
+	maxPrecision := p.GeohashPrecision
+	if maxPrecision <= 0 || maxPrecision > MaxPrecision {
+		maxPrecision = MaxPrecision
+	}
+	precision = min(precision, maxPrecision)
+
+	if p.Home != nil && geodesy.Distance(lat, lon, p.Home.Lat, p.Home.Lon)*1000 <= p.Home.RadiusM {
+		if p.Home.Action != HomeCoarsen {
+			return Position{}, false
+		}
+		if mode != ModeGeohash || precision > HomeCoarsePrecision {
+			mode, precision = ModeGeohash, min(HomeCoarsePrecision, maxPrecision)
+		}
+	}
+
+	switch mode {
+	case ModeGeohash:
+		return cell(lat, lon, precision), true
+	case ModeFuzz:
+		lat, lon = p.fuzz(lat, lon)
+		return Position{Lat: lat, Lon: lon, Geohash: geohash.EncodeWithPrecision(lat, lon, uint(maxPrecision)), Precise: true}, true
+	default:
+		return Position{Lat: lat, Lon: lon, Geohash: geohash.EncodeWithPrecision(lat, lon, uint(maxPrecision)), Precise: true}, true
+	}
+}
+
+func cell(lat, lon float64, precision int) Position {
+	hash := geohash.EncodeWithPrecision(lat, lon, uint(precision))
+	lat, lon = geohash.DecodeCenter(hash)
+	return Position{Lat: lat, Lon: lon, Geohash: hash}
+}
+
+// fuzz moves a point in a direction and by a distance, uniform over the disk
+// of radius FuzzM, derived from Key, Subject and the cell around the point.
+func (p Policy) fuzz(lat, lon float64) (float64, float64) {
+	radiusM := p.FuzzM
+	if radiusM <= 0 {
+		radiusM = DefaultFuzzM
+	}
+
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(p.Subject))
+	mac.Write([]byte{0})
+	mac.Write([]byte(geohash.EncodeWithPrecision(lat, lon, fuzzCellPrecision)))
+	sum := mac.Sum(nil)
+
+	u := float64(binary.BigEndian.Uint64(sum[0:8])) / math.MaxUint64
+	v := float64(binary.BigEndian.Uint64(sum[8:16])) / math.MaxUint64
+
+	bearing := 360 * u
+	distanceKm := radiusM / 1000 * math.Sqrt(v)
+	return geodesy.Destination(lat, lon, bearing, distanceKm)
+}
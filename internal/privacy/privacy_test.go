@@ -0,0 +1,124 @@
+package privacy
+
+import (
+	"testing"
+
+	"meshcore-map-api/internal/geodesy"
+)
+
+const (
+	testLat = 42.6977
+	testLon = 23.3219
+)
+
+func TestApplyExact(t *testing.T) {
+	pos, ok := Policy{}.Apply(testLat, testLon)
+	if !ok || !pos.Precise || pos.Lat != testLat || pos.Lon != testLon {
+		t.Errorf("Expected the exact position, got %+v", pos)
+	}
+	if len(pos.Geohash) != MaxPrecision {
+		t.Errorf("Expected a %d character geohash, got %q", MaxPrecision, pos.Geohash)
+	}
+
+	pos, _ = Policy{GeohashPrecision: 7}.Apply(testLat, testLon)
+	if !pos.Precise || len(pos.Geohash) != 7 {
+		t.Errorf("Expected a 7 character geohash, got %+v", pos)
+	}
+
+	pos, _ = Policy{Mode: ModeGeohash, Precision: 6, GeohashPrecision: 5}.Apply(testLat, testLon)
+	if len(pos.Geohash) != 5 {
+		t.Errorf("Expected the reporter's precision capped to 5, got %q", pos.Geohash)
+	}
+}
+
+func TestApplyGeohash(t *testing.T) {
+	tests := []struct {
+		precision int
+		want      int
+	}{
+		{4, 4},
+		{0, DefaultPrecision},
+		{12, DefaultPrecision},
+	}
+
+	for _, tt := range tests {
+		pos, ok := Policy{Mode: ModeGeohash, Precision: tt.precision}.Apply(testLat, testLon)
+		if !ok || pos.Precise {
+			t.Errorf("Precision %d: expected a geohash only position, got %+v", tt.precision, pos)
+		}
+		if len(pos.Geohash) != tt.want {
+			t.Errorf("Precision %d: expected a %d character geohash, got %q", tt.precision, tt.want, pos.Geohash)
+		}
+	}
+
+	// Every point in a cell resolves to the same position.
+	a, _ := Policy{Mode: ModeGeohash, Precision: 5}.Apply(testLat, testLon)
+	b, _ := Policy{Mode: ModeGeohash, Precision: 5}.Apply(testLat+0.001, testLon+0.001)
+	if a != b {
+		t.Errorf("Expected one position per cell, got %+v and %+v", a, b)
+	}
+}
+
+func TestApplyFuzz(t *testing.T) {
+	policy := Policy{Mode: ModeFuzz, FuzzM: 1000, Key: []byte("secret"), Subject: "reporter"}
+
+	moved := 0
+	for i := range 100 {
+		lat, lon := geodesy.Destination(testLat, testLon, float64(i)*37, float64(i)*0.5)
+		pos, ok := policy.Apply(lat, lon)
+		if !ok || !pos.Precise {
+			t.Fatalf("Expected a fuzzed position, got %+v", pos)
+		}
+		d := geodesy.Distance(lat, lon, pos.Lat, pos.Lon) * 1000
+		if d > 1000.01 {
+			t.Errorf("Offset %.1f m is beyond the radius", d)
+		}
+		if d > 1 {
+			moved++
+		}
+	}
+	if moved < 90 {
+		t.Errorf("Expected most points to move, %d of 100 did", moved)
+	}
+
+	// The offset is stable for a spot and depends on the key and subject.
+	a, _ := policy.Apply(testLat, testLon)
+	b, _ := policy.Apply(testLat, testLon)
+	if a != b {
+		t.Errorf("Expected the same offset for repeated reports, got %+v and %+v", a, b)
+	}
+	other := policy
+	other.Subject = "someone else"
+	if c, _ := other.Apply(testLat, testLon); c == a {
+		t.Errorf("Expected a different offset for another subject")
+	}
+	other = policy
+	other.Key = []byte("other secret")
+	if c, _ := other.Apply(testLat, testLon); c == a {
+		t.Errorf("Expected a different offset for another key")
+	}
+}
+
+func TestApplyHome(t *testing.T) {
+	nearLat, nearLon := geodesy.Destination(testLat, testLon, 90, 0.2)
+	farLat, farLon := geodesy.Destination(testLat, testLon, 90, 2)
+
+	drop := Policy{Home: &Home{Lat: testLat, Lon: testLon, RadiusM: 500, Action: HomeDrop}}
+	if _, ok := drop.Apply(nearLat, nearLon); ok {
+		t.Errorf("Expected a point in the home zone to be dropped")
+	}
+	if pos, ok := drop.Apply(farLat, farLon); !ok || !pos.Precise {
+		t.Errorf("Expected a point outside the home zone to be kept, got %+v", pos)
+	}
+
+	coarsen := Policy{Mode: ModeFuzz, Home: &Home{Lat: testLat, Lon: testLon, RadiusM: 500, Action: HomeCoarsen}}
+	if pos, ok := coarsen.Apply(nearLat, nearLon); !ok || pos.Precise || len(pos.Geohash) != HomeCoarsePrecision {
+		t.Errorf("Expected a point in the home zone to be coarsened, got %+v", pos)
+	}
+
+	// A coarser preference is kept.
+	coarser := Policy{Mode: ModeGeohash, Precision: 3, Home: coarsen.Home}
+	if pos, _ := coarser.Apply(nearLat, nearLon); len(pos.Geohash) != 3 {
+		t.Errorf("Expected the coarser precision to be kept, got %q", pos.Geohash)
+	}
+}
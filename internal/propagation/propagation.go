@@ -0,0 +1,202 @@
+package propagation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	FreeSpaceModel   = "free_space"
+	OkumuraHataModel = "okumura_hata"
+	LogDistanceModel = "log_distance"
+)
+
+const minDistanceKm = 0.001
+
+type Model interface {
+	Name() string
+	PathLoss(distanceKm float64) float64
+}
+
+type FreeSpace struct {
+	FreqMHz float64
+}
+
+func (m FreeSpace) Name() string {
+	return FreeSpaceModel
+}
+
+func (m FreeSpace) PathLoss(distanceKm float64) float64 {
+	distanceKm = math.Max(distanceKm, minDistanceKm)
+	return 20*math.Log10(distanceKm) + 20*math.Log10(m.FreqMHz) + 32.44
+}
+
+type Environment string
+
+const (
+	Urban    Environment = "urban"
+	Suburban Environment = "suburban"
+	Rural    Environment = "rural"
+)
+
+func ParseEnvironment(s string) (Environment, error) {
+	switch Environment(s) {
+	case Urban, Suburban, Rural:
+		return Environment(s), nil
+	case "":
+		return Suburban, nil
+	}
+	return "", fmt.Errorf("unknown environment: %s", s)
+}
+
+// OkumuraHata is the Hata formulation for small/medium cities, with the
+// standard suburban and open-area corrections.
+type OkumuraHata struct {
+	FreqMHz     float64
+	BaseHeightM float64
+	MobHeightM  float64
+	Environment Environment
+}
+
+func (m OkumuraHata) Name() string {
+	return OkumuraHataModel
+}
+
+func (m OkumuraHata) PathLoss(distanceKm float64) float64 {
+	distanceKm = math.Max(distanceKm, minDistanceKm)
+	hb := math.Max(m.BaseHeightM, 1)
+	hm := math.Max(m.MobHeightM, 1)
+	logF := math.Log10(m.FreqMHz)
+
+	aHm := (1.1*logF-0.7)*hm - (1.56*logF - 0.8)
+	urban := 69.55 + 26.16*logF - 13.82*math.Log10(hb) - aHm +
+		(44.9-6.55*math.Log10(hb))*math.Log10(distanceKm)
+
+	switch m.Environment {
+	case Urban:
+		return urban
+	case Rural:
+		return urban - 4.78*logF*logF + 18.33*logF - 40.94
+	default:
+		l := math.Log10(m.FreqMHz / 28)
+		return urban - 2*l*l - 5.4
+	}
+}
+
+type LogDistance struct {
+	RefLossDB     float64
+	RefDistanceKm float64
+	Exponent      float64
+}
+
+func (m LogDistance) Name() string {
+	return LogDistanceModel
+}
+
+func (m LogDistance) PathLoss(distanceKm float64) float64 {
+	distanceKm = math.Max(distanceKm, minDistanceKm)
+	ref := m.RefDistanceKm
+	if ref <= 0 {
+		ref = 1
+	}
+	return m.RefLossDB + 10*m.Exponent*math.Log10(distanceKm/ref)
+}
+
+type Sample struct {
+	DistanceKm float64
+	PathLossDB float64
+}
+
+type Fit struct {
+	Model   LogDistance
+	Samples int
+	RMSE    float64
+}
+
+var (
+	ErrNotEnoughSamples = errors.New("not enough samples to calibrate model")
+	ErrNarrowSpan       = errors.New("samples do not span enough distance to calibrate model")
+	// ErrNonPhysicalFit is a fit whose path loss doesn't grow with distance,
+	// e.g. from a handful of noisy samples.
+	ErrNonPhysicalFit = errors.New("calibrated path loss does not increase with distance")
+)
+
+const minFitSamples = 3
+
+// FitLogDistance calibrates a log-distance model (reference distance 1 km)
+// by least squares over log10(distance).
+func FitLogDistance(samples []Sample) (Fit, error) {
+	var n, sumX, sumY, sumXX, sumXY float64
+	for _, s := range samples {
+		if s.DistanceKm < 0.01 {
+			continue
+		}
+		x := math.Log10(s.DistanceKm)
+		n++
+		sumX += x
+		sumY += s.PathLossDB
+		sumXX += x * x
+		sumXY += x * s.PathLossDB
+	}
+
+	if n < minFitSamples {
+		return Fit{}, ErrNotEnoughSamples
+	}
+
+	denom := n*sumXX - sumX*sumX
+	if math.Abs(denom) < 1e-9 {
+		return Fit{}, ErrNarrowSpan
+	}
+
+	slope := (n*sumXY - sumX*sumY) / denom
+	if slope <= 0 {
+		return Fit{}, ErrNonPhysicalFit
+	}
+	intercept := (sumY - slope*sumX) / n
+
+	model := LogDistance{
+		RefLossDB:     intercept,
+		RefDistanceKm: 1,
+		Exponent:      slope / 10,
+	}
+
+	var sq float64
+	for _, s := range samples {
+		if s.DistanceKm < 0.01 {
+			continue
+		}
+		diff := s.PathLossDB - model.PathLoss(s.DistanceKm)
+		sq += diff * diff
+	}
+
+	return Fit{Model: model, Samples: int(n), RMSE: math.Sqrt(sq / n)}, nil
+}
+
+const (
+	minRangeKm = 0.001
+	maxRangeKm = 10000.0
+)
+
+// Range returns the distance at which the model's path loss reaches maxLossDB,
+// found by bisection in log-distance space. All models are monotonic in distance.
+func Range(m Model, maxLossDB float64) float64 {
+	if m.PathLoss(minRangeKm) >= maxLossDB {
+		return 0
+	}
+	if m.PathLoss(maxRangeKm) <= maxLossDB {
+		return maxRangeKm
+	}
+
+	lo, hi := math.Log10(minRangeKm), math.Log10(maxRangeKm)
+	for i := 0; i < 60; i++ {
+		mid := (lo + hi) / 2
+		if m.PathLoss(math.Pow(10, mid)) < maxLossDB {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return math.Pow(10, (lo+hi)/2)
+}
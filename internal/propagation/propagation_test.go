@@ -0,0 +1,105 @@
+package propagation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFreeSpace(t *testing.T) {
+	m := FreeSpace{FreqMHz: 868}
+	got := m.PathLoss(1)
+	if math.Abs(got-91.21) > 0.05 {
+		t.Errorf("Expected ~91.2 dB at 1 km, got %.2f", got)
+	}
+
+	if m.PathLoss(10)-m.PathLoss(1) < 19.9 {
+		t.Errorf("Expected 20 dB per decade")
+	}
+}
+
+func TestOkumuraHataEnvironments(t *testing.T) {
+	base := OkumuraHata{FreqMHz: 868, BaseHeightM: 30, MobHeightM: 1.5}
+
+	base.Environment = Urban
+	urban := base.PathLoss(5)
+	base.Environment = Suburban
+	suburban := base.PathLoss(5)
+	base.Environment = Rural
+	rural := base.PathLoss(5)
+
+	if !(urban > suburban && suburban > rural) {
+		t.Errorf("Expected urban > suburban > rural, got %.1f, %.1f, %.1f", urban, suburban, rural)
+	}
+}
+
+func TestFitLogDistance(t *testing.T) {
+	truth := LogDistance{RefLossDB: 110, RefDistanceKm: 1, Exponent: 3.2}
+
+	var samples []Sample
+	for _, d := range []float64{0.2, 0.5, 1, 2, 4, 8} {
+		samples = append(samples, Sample{DistanceKm: d, PathLossDB: truth.PathLoss(d)})
+	}
+
+	fit, err := FitLogDistance(samples)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if math.Abs(fit.Model.Exponent-3.2) > 1e-6 || math.Abs(fit.Model.RefLossDB-110) > 1e-6 {
+		t.Errorf("Expected exponent 3.2 and ref loss 110, got %.3f and %.3f", fit.Model.Exponent, fit.Model.RefLossDB)
+	}
+	if fit.RMSE > 1e-6 {
+		t.Errorf("Expected zero RMSE, got %f", fit.RMSE)
+	}
+}
+
+func TestFitLogDistanceNotEnoughSamples(t *testing.T) {
+	_, err := FitLogDistance([]Sample{{DistanceKm: 1, PathLossDB: 100}})
+	if err != ErrNotEnoughSamples {
+		t.Errorf("Expected ErrNotEnoughSamples, got %v", err)
+	}
+}
+
+func TestFitLogDistanceUnusableSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []Sample
+		err     error
+	}{
+		{
+			name:    "Same distance",
+			samples: []Sample{{DistanceKm: 2, PathLossDB: 100}, {DistanceKm: 2, PathLossDB: 110}, {DistanceKm: 2, PathLossDB: 105}},
+			err:     ErrNarrowSpan,
+		},
+		{
+			name:    "Loss falling with distance",
+			samples: []Sample{{DistanceKm: 1, PathLossDB: 120}, {DistanceKm: 2, PathLossDB: 110}, {DistanceKm: 4, PathLossDB: 100}},
+			err:     ErrNonPhysicalFit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FitLogDistance(tt.samples); err != tt.err {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	m := FreeSpace{FreqMHz: 868}
+	loss := m.PathLoss(25)
+
+	if got := Range(m, loss); math.Abs(got-25) > 0.001 {
+		t.Errorf("Expected 25 km, got %.4f", got)
+	}
+
+	if got := Range(m, 0); got != 0 {
+		t.Errorf("Expected zero range for zero budget, got %f", got)
+	}
+
+	if got := Range(m, 1000); got != maxRangeKm {
+		t.Errorf("Expected range to be capped at %f, got %f", maxRangeKm, got)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"meshcore-map-api/internal/lora"
+	"meshcore-map-api/internal/propagation"
+)
+
+const defaultPathLossExponent = 3.0
+
+var defaultPayloadSizes = []int{16, 64, 128, 255}
+
+type LinkBudgetRequest struct {
+	Radio            RadioInfo `json:"radio" validate:"required"`
+	TxAntennaGain    float64   `json:"txAntennaGain"`
+	RxAntennaGain    float64   `json:"rxAntennaGain"`
+	TxCableLoss      float64   `json:"txCableLoss" validate:"gte=0"`
+	RxCableLoss      float64   `json:"rxCableLoss" validate:"gte=0"`
+	FadeMargin       float64   `json:"fadeMargin" validate:"gte=0"`
+	NoiseFigure      *float64  `json:"noiseFigure" validate:"omitempty,gt=0,lte=20"`
+	PreambleLength   int       `json:"preambleLength" validate:"omitempty,min=6,max=65535"`
+	PayloadSizes     []int     `json:"payloadSizes" validate:"omitempty,max=32,dive,min=0,max=255"`
+	TxHeight         *float64  `json:"txHeight" validate:"omitempty,gt=0,lte=500"`
+	RxHeight         *float64  `json:"rxHeight" validate:"omitempty,gt=0,lte=500"`
+	PathLossExponent *float64  `json:"pathLossExponent" validate:"omitempty,gt=1,lte=6"`
+}
+
+type RangeEstimate struct {
+	Model       string  `json:"model"`
+	Environment string  `json:"environment,omitempty"`
+	DistanceKm  float64 `json:"distanceKm"`
+}
+
+type LinkBudgetResponse struct {
+	Preset         string          `json:"preset"`
+	SensitivityDBm float64         `json:"sensitivityDbm"`
+	EIRPDBm        float64         `json:"eirpDbm"`
+	MaxPathLossDB  float64         `json:"maxPathLossDb"`
+	TimeOnAir      []lora.Airtime  `json:"timeOnAir"`
+	Ranges         []RangeEstimate `json:"ranges"`
+}
+
+func handleLinkBudget(c *gin.Context) {
+	var request LinkBudgetRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := computeLinkBudget(request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func computeLinkBudget(request LinkBudgetRequest) (*LinkBudgetResponse, error) {
+	radio := request.Radio
+
+	sensitivity, err := lora.Sensitivity(radio.SF, radio.BW, ptrValueOr(request.NoiseFigure, lora.DefaultNoiseFigure))
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := request.PayloadSizes
+	if len(payloads) == 0 {
+		payloads = defaultPayloadSizes
+	}
+
+	airtimes := make([]lora.Airtime, 0, len(payloads))
+	for _, size := range payloads {
+		airtime, err := lora.TimeOnAir(size, lora.AirtimeParams{
+			SF:             radio.SF,
+			BWKHz:          radio.BW,
+			CR:             radio.CR,
+			PreambleLength: request.PreambleLength,
+			ExplicitHeader: true,
+			CRC:            true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		airtimes = append(airtimes, airtime)
+	}
+
+	eirp := float64(radio.TX) + request.TxAntennaGain - request.TxCableLoss
+	maxLoss := eirp + request.RxAntennaGain - request.RxCableLoss - sensitivity - request.FadeMargin
+
+	txHeight := ptrValueOr(request.TxHeight, defaultTxHeightM)
+	rxHeight := ptrValueOr(request.RxHeight, defaultRxHeightM)
+	freeSpace := propagation.FreeSpace{FreqMHz: radio.Freq}
+
+	ranges := []RangeEstimate{
+		{Model: propagation.FreeSpaceModel, DistanceKm: propagation.Range(freeSpace, maxLoss)},
+	}
+
+	for _, env := range []propagation.Environment{propagation.Urban, propagation.Suburban, propagation.Rural} {
+		hata := propagation.OkumuraHata{
+			FreqMHz:     radio.Freq,
+			BaseHeightM: txHeight,
+			MobHeightM:  rxHeight,
+			Environment: env,
+		}
+		ranges = append(ranges, RangeEstimate{
+			Model:       propagation.OkumuraHataModel,
+			Environment: string(env),
+			DistanceKm:  propagation.Range(hata, maxLoss),
+		})
+	}
+
+	logDistance := propagation.LogDistance{
+		RefLossDB:     freeSpace.PathLoss(1),
+		RefDistanceKm: 1,
+		Exponent:      ptrValueOr(request.PathLossExponent, defaultPathLossExponent),
+	}
+	ranges = append(ranges, RangeEstimate{
+		Model:      propagation.LogDistanceModel,
+		DistanceKm: propagation.Range(logDistance, maxLoss),
+	})
+
+	return &LinkBudgetResponse{
+		Preset:         radio.Preset(),
+		SensitivityDBm: sensitivity,
+		EIRPDBm:        eirp,
+		MaxPathLossDB:  maxLoss,
+		TimeOnAir:      airtimes,
+		Ranges:         ranges,
+	}, nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmcloughlin/geohash"
+
+	"meshcore-map-api/internal/dem"
+	"meshcore-map-api/internal/geodesy"
+)
+
+const (
+	defaultLinkFreqMHz   = 869.618
+	defaultLOSSamples    = 256
+	defaultLinkSamples   = 64
+	defaultLinkPrecision = 7
+	defaultLinkLimit     = 100
+	maxLOSDistanceKm     = 300.0
+)
+
+type LOSQuery struct {
+	From       string   `form:"from" validate:"required"`
+	To         string   `form:"to" validate:"required"`
+	FromHeight *float64 `form:"from_height" validate:"omitempty,gte=0,lte=500"`
+	ToHeight   *float64 `form:"to_height" validate:"omitempty,gte=0,lte=500"`
+	Freq       float64  `form:"freq" validate:"omitempty,min=433,max=928"`
+	Samples    int      `form:"samples" validate:"omitempty,min=2,max=2000"`
+}
+
+type LinksQuery struct {
+	Preset    string   `form:"preset" validate:"omitempty,radio_preset"`
+	Precision int      `form:"precision" validate:"omitempty,min=4,max=8"`
+	Limit     int      `form:"limit" validate:"omitempty,min=1,max=1000"`
+	RxHeight  *float64 `form:"rx_height" validate:"omitempty,gte=0,lte=500"`
+}
+
+type Link struct {
+	Geohash    string        `json:"geohash"`
+	Lat        float64       `json:"lat"`
+	Lon        float64       `json:"lon"`
+	DistanceKm float64       `json:"distanceKm"`
+	Reports    uint64        `json:"reports"`
+	AvgRSSI    float64       `json:"avgRssi"`
+	AvgSNR     float64       `json:"avgSnr"`
+	LastSeen   time.Time     `json:"lastSeen"`
+	Terrain    *dem.Analysis `json:"terrain,omitempty"`
+}
+
+func handleLOS(c *gin.Context) {
+	var query LOSQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	fromLat, fromLon, err := parseLatLon(query.From)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid from: " + err.Error()})
+		return
+	}
+
+	toLat, toLon, err := parseLatLon(query.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid to: " + err.Error()})
+		return
+	}
+
+	if geodesy.Distance(fromLat, fromLon, toLat, toLon) > maxLOSDistanceKm {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Path longer than %.0f km", maxLOSDistanceKm)})
+		return
+	}
+
+	analysis, err := terrain.Analyze(dem.LinkParams{
+		FromLat:     fromLat,
+		FromLon:     fromLon,
+		FromHeightM: ptrValueOr(query.FromHeight, defaultTxHeightM),
+		ToLat:       toLat,
+		ToLon:       toLon,
+		ToHeightM:   ptrValueOr(query.ToHeight, defaultRxHeightM),
+		FreqMHz:     valueOr(query.Freq, defaultLinkFreqMHz),
+		Samples:     intValueOr(query.Samples, defaultLOSSamples),
+	})
+	if errors.Is(err, dem.ErrNoData) {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "No terrain data for this path"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error analyzing line of sight", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to analyze line of sight"})
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
+
+func handleLinks(c *gin.Context) {
+	pubkey := c.Param("pubkey")
+	if err := validate.Var(pubkey, "len=64,hexadecimal"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid repeater public key"})
+		return
+	}
+
+	var query LinksQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	repeater, err := getRepeater(pubkey)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading repeater", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load repeater"})
+		return
+	}
+	if repeater == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Repeater not found"})
+		return
+	}
+
+	links, err := getLinks(pubkey, query.Preset, intValueOr(query.Precision, defaultLinkPrecision), intValueOr(query.Limit, defaultLinkLimit))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading links", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load links"})
+		return
+	}
+
+	if repeater.Lat != nil && repeater.Lon != nil {
+		freq := defaultLinkFreqMHz
+		if radio, err := getLatestRadio(pubkey, query.Preset); err == nil && radio != nil {
+			freq = radio.Freq
+		}
+
+		for i := range links {
+			links[i].DistanceKm = geodesy.Distance(*repeater.Lat, *repeater.Lon, links[i].Lat, links[i].Lon)
+
+			analysis, err := terrain.Analyze(dem.LinkParams{
+				FromLat:     *repeater.Lat,
+				FromLon:     *repeater.Lon,
+				FromHeightM: repeater.antennaHeightOr(defaultTxHeightM),
+				ToLat:       links[i].Lat,
+				ToLon:       links[i].Lon,
+				ToHeightM:   ptrValueOr(query.RxHeight, defaultRxHeightM),
+				FreqMHz:     freq,
+				Samples:     defaultLinkSamples,
+			})
+			if err != nil {
+				if !errors.Is(err, dem.ErrNoData) {
+					slog.ErrorContext(c.Request.Context(), "Error analyzing link terrain", "error", err)
+				}
+				continue
+			}
+			analysis.Profile = nil
+			links[i].Terrain = analysis
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"repeater": pubkey, "links": links})
+}
+
+func getLinks(pubkey, preset string, precision, limit int) ([]Link, error) {
+	ctx := context.Background()
+
+	where, args := repeaterReportsFilter(pubkey, preset)
+
+	// Raw reports from the retention cutoff on, daily aggregates before it.
+	// The aggregates hold no positions, so a link only heard before the cutoff
+	// is placed at the centre of its cell.
+	cutoff := rawDataCutoff(time.Now())
+	rawArgs := append(append([]any{precision}, args...), cutoff)
+	dailyArgs := append(append([]any{precision}, args...), cutoff)
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT
+			cell,
+			sum(cell_reports) AS reports,
+			sum(rssi_sum) / reports,
+			sum(snr_sum) / reports,
+			max(last_seen),
+			if(sum(located) > 0, sum(latitude_sum) / sum(located), NULL),
+			if(sum(located) > 0, sum(longitude_sum) / sum(located), NULL)
+		FROM (
+			SELECT
+				substring(geohash, 1, ?) AS cell,
+				count() AS cell_reports,
+				sum(toInt64(rssi)) AS rssi_sum,
+				sum(toFloat64(snr)) AS snr_sum,
+				max(timestamp) AS last_seen,
+				countIf(latitude IS NOT NULL AND longitude IS NOT NULL) AS located,
+				sum(ifNull(latitude, 0)) AS latitude_sum,
+				sum(ifNull(longitude, 0)) AS longitude_sum
+			FROM repeater_reports
+			WHERE %[1]s AND timestamp >= ?
+			GROUP BY cell
+			UNION ALL
+			SELECT
+				substring(geohash, 1, ?) AS cell,
+				sum(reports),
+				sum(rssi_sum),
+				sum(snr_sum),
+				max(last_seen),
+				toUInt64(0),
+				toFloat64(0),
+				toFloat64(0)
+			FROM repeater_reports_daily
+			WHERE %[1]s AND day < toDate(?)
+			GROUP BY cell
+		)
+		GROUP BY cell
+		ORDER BY reports DESC
+		LIMIT ?
+	`, where), append(append(rawArgs, dailyArgs...), limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query links: %w", err)
+	}
+	defer rows.Close()
+
+	links := make([]Link, 0)
+	for rows.Next() {
+		var l Link
+		var lat, lon *float64
+		if err := rows.Scan(&l.Geohash, &l.Reports, &l.AvgRSSI, &l.AvgSNR, &l.LastSeen, &lat, &lon); err != nil {
+			return nil, fmt.Errorf("failed to scan link: %w", err)
+		}
+
+		if lat != nil && lon != nil {
+			l.Lat, l.Lon = *lat, *lon
+		} else {
+			l.Lat, l.Lon = geohash.DecodeCenter(l.Geohash)
+		}
+
+		links = append(links, l)
+	}
+
+	return links, rows.Err()
+}
+
+func parseLatLon(s string) (float64, float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected lat,lon")
+	}
+
+	lat, err := parseCoordinate(strings.TrimSpace(parts[0]))
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("invalid latitude")
+	}
+
+	lon, err := parseCoordinate(strings.TrimSpace(parts[1]))
+	if err != nil || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("invalid longitude")
+	}
+
+	return lat, lon, nil
+}
+
+func intValueOr(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// ptrValueOr is valueOr for optional parameters where 0 is a valid value.
+func ptrValueOr(v *float64, def float64) float64 {
+	if v == nil {
+		return def
+	}
+	return *v
+}
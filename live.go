@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmcloughlin/geohash"
+
+	"meshcore-map-api/internal/privacy"
+)
+
+const (
+	// liveBuffer is the number of events queued for a slow client before
+	// further ones are dropped.
+	liveBuffer    = 256
+	liveKeepAlive = 15 * time.Second
+)
+
+type LiveQuery struct {
+	// BBox is minLon,minLat,maxLon,maxLat. minLon > maxLon crosses the
+	// antimeridian.
+	BBox     string `form:"bbox"`
+	Repeater string `form:"repeater" validate:"omitempty,len=64,hexadecimal"`
+	Preset   string `form:"preset" validate:"omitempty,radio_preset"`
+}
+
+// Positions of reports and dead zones are the centre of their stored geohash
+// cell, never the stored coordinates.
+type LiveReport struct {
+	Timestamp      time.Time `json:"timestamp"`
+	RepeaterPubkey string    `json:"repeaterPubkey"`
+	RepeaterName   string    `json:"repeaterName"`
+	ReporterName   string    `json:"reporterName"`
+	RSSI           int       `json:"rssi"`
+	SNR            float64   `json:"snr"`
+	Preset         string    `json:"preset,omitempty"`
+	Geohash        string    `json:"geohash"`
+	Lat            float64   `json:"lat"`
+	Lon            float64   `json:"lon"`
+}
+
+type LiveRepeater struct {
+	Timestamp time.Time `json:"timestamp"`
+	PublicKey string    `json:"publicKey"`
+	Name      string    `json:"name"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+}
+
+type LiveDeadZone struct {
+	Timestamp    time.Time `json:"timestamp"`
+	ReporterName string    `json:"reporterName"`
+	Preset       string    `json:"preset,omitempty"`
+	Geohash      string    `json:"geohash"`
+	Lat          float64   `json:"lat"`
+	Lon          float64   `json:"lon"`
+}
+
+// liveEvent is an SSE event with what clients filter it on.
+type liveEvent struct {
+	name     string
+	lat, lon float64
+	repeater string
+	// preset is empty for repeater upserts, which aren't sent on a preset.
+	preset string
+	data   any
+}
+
+type liveFilter struct {
+	bbox     *[4]float64
+	repeater string
+	preset   string
+}
+
+// liveFeed fans stored data out to the clients of GET /live.
+type liveFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan liveEvent]struct{}
+	closed      bool
+}
+
+var live = &liveFeed{subscribers: make(map[chan liveEvent]struct{})}
+
+// subscribe returns a channel of published events, or false when the feed is
+// full or closed.
+func (f *liveFeed) subscribe() (chan liveEvent, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed || len(f.subscribers) >= cfg.Live.MaxSubscribers {
+		return nil, false
+	}
+	events := make(chan liveEvent, liveBuffer)
+	f.subscribers[events] = struct{}{}
+	liveSubscribers.Set(float64(len(f.subscribers)))
+	return events, true
+}
+
+func (f *liveFeed) unsubscribe(events chan liveEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.subscribers[events]; ok {
+		delete(f.subscribers, events)
+		close(events)
+	}
+	liveSubscribers.Set(float64(len(f.subscribers)))
+}
+
+// publish sends events to every subscriber without waiting for slow ones.
+func (f *liveFeed) publish(events ...liveEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for subscriber := range f.subscribers {
+		for _, event := range events {
+			select {
+			case subscriber <- event:
+				liveEvents.WithLabelValues(event.name).Inc()
+			default:
+				liveEventsDropped.Inc()
+			}
+		}
+	}
+}
+
+// close ends every stream, so shutdown doesn't wait for them.
+func (f *liveFeed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for subscriber := range f.subscribers {
+		delete(f.subscribers, subscriber)
+		close(subscriber)
+	}
+	liveSubscribers.Set(0)
+}
+
+func handleLive(c *gin.Context) {
+	var query LiveQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	filter := liveFilter{repeater: strings.ToLower(query.Repeater), preset: query.Preset}
+	if query.BBox != "" {
+		bbox, err := parseBBox(query.BBox)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid bbox: " + err.Error()})
+			return
+		}
+		filter.bbox = &bbox
+	}
+
+	events, ok := live.subscribe()
+	if !ok {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Too many live clients"})
+		return
+	}
+	defer live.unsubscribe(events)
+
+	// The stream lasts until the client goes away.
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", gin.H{"status": "ok"})
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if filter.match(event) {
+				c.SSEvent(event.name, event.data)
+			}
+			return true
+		case <-keepAlive.C:
+			// A comment, ignored by clients, keeps proxies from closing
+			// an idle stream.
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		}
+	})
+}
+
+func (f liveFilter) match(e liveEvent) bool {
+	if f.repeater != "" && f.repeater != e.repeater {
+		return false
+	}
+	if f.preset != "" && e.preset != "" && f.preset != e.preset {
+		return false
+	}
+	if f.bbox == nil {
+		return true
+	}
+	minLon, minLat, maxLon, maxLat := f.bbox[0], f.bbox[1], f.bbox[2], f.bbox[3]
+	if e.lat < minLat || e.lat > maxLat {
+		return false
+	}
+	if minLon <= maxLon {
+		return e.lon >= minLon && e.lon <= maxLon
+	}
+	return e.lon >= minLon || e.lon <= maxLon
+}
+
+func parseBBox(s string) ([4]float64, error) {
+	var bbox [4]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return bbox, fmt.Errorf("expected minLon,minLat,maxLon,maxLat")
+	}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return bbox, fmt.Errorf("invalid number %q", part)
+		}
+		bbox[i] = v
+	}
+	if bbox[0] < -180 || bbox[0] > 180 || bbox[2] < -180 || bbox[2] > 180 {
+		return bbox, fmt.Errorf("longitudes must be between -180 and 180")
+	}
+	if bbox[1] < -90 || bbox[3] > 90 || bbox[1] > bbox[3] {
+		return bbox, fmt.Errorf("latitudes must be between -90 and 90, minLat first")
+	}
+	return bbox, nil
+}
+
+// liveCell is the centre of the stored geohash cell of a position.
+func liveCell(position privacy.Position) (lat, lon float64) {
+	return geohash.DecodeCenter(position.Geohash)
+}
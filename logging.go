@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+
+	"meshcore-map-api/internal/config"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+// Incoming request IDs are kept only if they can't garble the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// Routes polled by probes and scrapers are logged at debug level unless
+// they fail.
+var quietRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// coordinateKeys are the attributes holding positions, logged only when
+// precise locations are stored.
+var coordinateKeys = map[string]bool{
+	"lat":       true,
+	"lon":       true,
+	"latitude":  true,
+	"longitude": true,
+}
+
+// setupLogging makes the default slog logger, and the log package, write
+// records in the configured format and level.
+func setupLogging(c config.Log) {
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, c)))
+}
+
+func newLogHandler(w io.Writer, c config.Log) slog.Handler {
+	var level slog.Level
+	// Validated by config.Load.
+	_ = level.UnmarshalText([]byte(c.Level))
+
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redactCoordinates}
+	if c.Format == "text" {
+		return contextHandler{slog.NewTextHandler(w, options)}
+	}
+	return contextHandler{slog.NewJSONHandler(w, options)}
+}
+
+func redactCoordinates(groups []string, a slog.Attr) slog.Attr {
+	if !storePreciseLocation && coordinateKeys[a.Key] {
+		return slog.String(a.Key, "redacted")
+	}
+	return a
+}
+
+// contextHandler adds the request and trace IDs of the context a record is
+// logged with.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// logRequests assigns every request an ID, kept from the X-Request-Id
+// header if the client sent one, and writes the access log.
+func logRequests(c *gin.Context) {
+	start := time.Now()
+
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = uuid.NewString()
+	}
+	c.Header(requestIDHeader, id)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+
+	c.Next()
+
+	status := c.Writer.Status()
+	route := c.FullPath()
+	level := slog.LevelInfo
+	switch {
+	case status >= http.StatusInternalServerError:
+		level = slog.LevelError
+	case status >= http.StatusBadRequest:
+		level = slog.LevelWarn
+	case quietRoutes[route]:
+		level = slog.LevelDebug
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", c.Request.Method),
+		slog.String("route", route),
+		slog.String("path", c.Request.URL.Path),
+		slog.Int("status", status),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		slog.Int("bytes", c.Writer.Size()),
+		slog.String("client_ip", c.ClientIP()),
+	}
+	if category := c.GetString("errorCategory"); category != "" {
+		attrs = append(attrs, slog.String("error_category", category))
+	}
+	slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+}
+
+// recoverPanic logs a panicking handler with its stack and responds 500.
+func recoverPanic(c *gin.Context, err any) {
+	slog.ErrorContext(c.Request.Context(), "Handler panicked", "error", err, "stack", string(debug.Stack()))
+	c.AbortWithStatus(http.StatusInternalServerError)
+}
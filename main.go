@@ -2,20 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
-	"github.com/mmcloughlin/geohash"
 
+	"meshcore-map-api/internal/bandplan"
+	"meshcore-map-api/internal/config"
+	"meshcore-map-api/internal/dem"
 	"meshcore-map-api/internal/geocoder"
+	"meshcore-map-api/internal/lora"
+	"meshcore-map-api/internal/privacy"
 )
 
 type RadioInfo struct {
@@ -26,12 +35,48 @@ type RadioInfo struct {
 	TX   int     `json:"tx" validate:"required,gt=0"`
 }
 
+func (r RadioInfo) Preset() string {
+	return lora.Classify(r.Freq, r.BW, r.SF, r.CR)
+}
+
 type Metadata struct {
-	Name      string    `json:"name" validate:"required"`
-	Pubkey    string    `json:"pubkey" validate:"required"`
-	Radio     RadioInfo `json:"radio" validate:"required"`
-	Latitude  string    `json:"latitude" validate:"omitempty,latitude"`
-	Longitude string    `json:"longitude" validate:"omitempty,longitude"`
+	Name      string              `json:"name" validate:"required"`
+	Pubkey    string              `json:"pubkey" validate:"required,len=64,hexadecimal"`
+	Radio     RadioInfo           `json:"radio" validate:"required"`
+	Latitude  string              `json:"latitude" validate:"omitempty,latitude"`
+	Longitude string              `json:"longitude" validate:"omitempty,longitude"`
+	Privacy   *PrivacyPreferences `json:"privacy,omitempty"`
+}
+
+// PrivacyPreferences is how precisely a reporter's positions are stored.
+// The home zone is only used to filter points and is never stored.
+type PrivacyPreferences struct {
+	Mode             string    `json:"mode" validate:"omitempty,oneof=exact geohash fuzz"`
+	GeohashPrecision int       `json:"geohashPrecision" validate:"omitempty,min=1,max=8"`
+	FuzzRadiusM      float64   `json:"fuzzRadiusM" validate:"omitempty,gt=0,max=10000"`
+	Home             *HomeZone `json:"home,omitempty"`
+}
+
+type HomeZone struct {
+	Latitude  float64 `json:"latitude" validate:"required,min=-90,max=90"`
+	Longitude float64 `json:"longitude" validate:"required,min=-180,max=180"`
+	RadiusM   float64 `json:"radiusM" validate:"required,gt=0,max=10000"`
+	Action    string  `json:"action" validate:"omitempty,oneof=drop coarsen"`
+}
+
+func (m Metadata) PrivacyPolicy() privacy.Policy {
+	policy := privacy.Policy{Key: locationFuzzKey, Subject: m.Pubkey, GeohashPrecision: cfg.Privacy.GeohashPrecision}
+	if m.Privacy == nil {
+		return policy
+	}
+
+	policy.Mode = m.Privacy.Mode
+	policy.Precision = m.Privacy.GeohashPrecision
+	policy.FuzzM = m.Privacy.FuzzRadiusM
+	if home := m.Privacy.Home; home != nil {
+		policy.Home = &privacy.Home{Lat: home.Latitude, Lon: home.Longitude, RadiusM: home.RadiusM, Action: home.Action}
+	}
+	return policy
 }
 
 type DeviceData struct {
@@ -56,10 +101,11 @@ type RepeaterMetadata struct {
 }
 
 type RepeaterData struct {
-	PublicKey string  `json:"publicKey" validate:"required,len=64,hexadecimal"`
-	Name      string  `json:"name" validate:"required"`
-	Lat       float64 `json:"lat" validate:"required,min=-90,max=90"`
-	Lon       float64 `json:"lon" validate:"required,min=-180,max=180"`
+	PublicKey     string   `json:"publicKey" validate:"required,len=64,hexadecimal"`
+	Name          string   `json:"name" validate:"required"`
+	Lat           float64  `json:"lat" validate:"required,min=-90,max=90"`
+	Lon           float64  `json:"lon" validate:"required,min=-180,max=180"`
+	AntennaHeight *float64 `json:"antennaHeight,omitempty" validate:"omitempty,gte=0,lte=500"`
 }
 
 type RepeaterRequest struct {
@@ -71,74 +117,87 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+var cfg config.Config
 var validate *validator.Validate
 var db driver.Conn
 var geo *geocoder.Geocoder
+var terrain *dem.DEM
 var storePreciseLocation bool
+var locationFuzzKey []byte
 
 func init() {
 	validate = validator.New()
 	validate.RegisterValidation("timestamp", validateTimestamp)
 	validate.RegisterValidation("latitude", validateLatitude)
 	validate.RegisterValidation("longitude", validateLongitude)
+	validate.RegisterValidation("radio_preset", validateRadioPreset)
 	validate.RegisterStructValidation(ReportRequestStructLevelValidation, ReportRequest{})
+}
 
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: Error loading .env file: %v", err)
-	}
+// loadConfig builds the configuration from the defaults, the config file,
+// the environment, .env if present, and the flags in args, and returns the
+// arguments left after the flags.
+func loadConfig(args []string) ([]string, error) {
+	dotenvErr := godotenv.Load()
 
 	var err error
-	db, err = initClickHouse()
+	cfg, args, err = config.Load(args, os.Getenv)
 	if err != nil {
-		log.Fatalf("Failed to initialize ClickHouse: %v", err)
+		return nil, err
+	}
+
+	setupLogging(cfg.Log)
+	if dotenvErr != nil {
+		slog.Warn("Error loading .env file", "error", dotenvErr)
 	}
 
-	log.Println("Loading geocoding data...")
-	geo = geocoder.GetInstance()
-	log.Println("Geocoding data loaded successfully")
+	rawRetentionDays = cfg.Retention.RawDays
 
-	storePreciseLocation = os.Getenv("STORE_PRECISE_LOCATION") != "false"
+	storePreciseLocation = cfg.Privacy.StorePreciseLocation
 	if storePreciseLocation {
-		log.Println("Storing precise location (latitude/longitude)")
+		slog.Info("Storing precise location (latitude/longitude)")
 	} else {
-		log.Println("Storing only geohash (precise location disabled)")
+		slog.Info("Storing only geohash (precise location disabled)")
 	}
-}
 
-func initClickHouse() (driver.Conn, error) {
-	host := os.Getenv("CLICKHOUSE_HOST")
-	port := os.Getenv("CLICKHOUSE_PORT")
-	database := os.Getenv("CLICKHOUSE_DATABASE")
-	user := os.Getenv("CLICKHOUSE_USER")
-	password := os.Getenv("CLICKHOUSE_PASSWORD")
-
-	conn, err := clickhouse.Open(&clickhouse.Options{
-		Addr: []string{fmt.Sprintf("%s:%s", host, port)},
-		Auth: clickhouse.Auth{
-			Database: database,
-			Username: user,
-			Password: password,
-		},
-		Settings: clickhouse.Settings{
-			"max_execution_time": 60,
-		},
-		DialTimeout:      time.Second * 30,
-		MaxOpenConns:     10,
-		MaxIdleConns:     5,
-		ConnMaxLifetime:  time.Hour,
-		ConnOpenStrategy: clickhouse.ConnOpenInOrder,
-	})
+	// A key generated per start would give every spot a new offset after each
+	// restart, and averaging those recovers the position.
+	locationFuzzKey = nil
+	if key := cfg.Privacy.LocationFuzzKey; key != "" {
+		locationFuzzKey = []byte(key)
+	} else {
+		slog.Warn("LOCATION_FUZZ_KEY not set, reports asking for fuzzed positions will be rejected")
+	}
+	return args, nil
+}
 
+// openDependencies connects to ClickHouse and loads the geocoding and
+// terrain data. Missing geocoding or terrain data only disables the features
+// using them.
+func openDependencies() error {
+	var err error
+	db, err = initClickHouse()
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to initialize ClickHouse: %w", err)
 	}
 
-	if err := conn.Ping(context.Background()); err != nil {
-		return nil, err
+	slog.Info("Loading geocoding data")
+	geo = geocoder.New(geocoderOptions())
+	if err := geo.Reload(); err != nil {
+		slog.Error("Failed to load geocoding data, starting without geocoding", "error", err)
+	} else {
+		slog.Info("Geocoding data loaded successfully")
 	}
 
-	log.Println("Successfully connected to ClickHouse")
-	return conn, nil
+	geo.SetMaxDistance(cfg.Geocoder.MaxDistanceKm)
+
+	terrain = dem.New(cfg.Terrain.DEMDir)
+	if terrain.Available() {
+		slog.Info("Terrain data found", "dir", cfg.Terrain.DEMDir)
+	} else {
+		slog.Warn("No terrain data, line-of-sight analysis disabled", "dir", cfg.Terrain.DEMDir)
+	}
+	return nil
 }
 
 func validateTimestamp(fl validator.FieldLevel) bool {
@@ -175,6 +234,10 @@ func validateLongitude(fl validator.FieldLevel) bool {
 	return lon >= -180 && lon <= 180
 }
 
+func validateRadioPreset(fl validator.FieldLevel) bool {
+	return lora.IsKnownPreset(fl.Field().String())
+}
+
 func ReportRequestStructLevelValidation(sl validator.StructLevel) {
 	report := sl.Current().Interface().(ReportRequest)
 
@@ -192,29 +255,56 @@ func handleReport(c *gin.Context) {
 	var report ReportRequest
 
 	if err := c.ShouldBindJSON(&report); err != nil {
+		reject(c, "invalid_json", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON: " + err.Error()})
 		return
 	}
 
-	if err := validate.Struct(&report); err != nil {
+	ctx := c.Request.Context()
+	_, span := tracer.Start(ctx, "validate")
+	err := validate.Struct(&report)
+	endSpan(span, err)
+	if err != nil {
+		reject(c, "invalid", err, "reporter_pubkey", report.Metadata.Pubkey)
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	log.Printf("Received valid report from: %s\n", report.Metadata.Name)
+	if p := report.Metadata.Privacy; p != nil && p.Mode == privacy.ModeFuzz && locationFuzzKey == nil {
+		reject(c, "invalid", errors.New("fuzz mode without LOCATION_FUZZ_KEY"), "reporter_pubkey", report.Metadata.Pubkey)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Fuzzed positions are not available on this server"})
+		return
+	}
 
 	if len(report.Data) == 0 {
-		if err := insertDeadZoneData(report); err != nil {
-			log.Printf("Error inserting dead zone data: %v", err)
+		cell, err := insertDeadZoneData(ctx, report)
+		if err != nil {
+			reject(c, storageErrorReason(err), err, "reporter_pubkey", report.Metadata.Pubkey)
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to store dead zone"})
 			return
 		}
+		// Only the stored cell is logged: the request coordinates may be
+		// more precise than the reporter allows storing.
+		if cell != "" {
+			slog.InfoContext(ctx, "Stored dead zone",
+				"reporter_name", report.Metadata.Name,
+				"reporter_pubkey", report.Metadata.Pubkey,
+				"geohash", cell)
+		}
+		reportsAccepted.WithLabelValues("dead_zone").Inc()
 	} else {
-		if err := insertReportData(report); err != nil {
-			log.Printf("Error inserting report data: %v", err)
+		rows, err := insertReportData(ctx, report)
+		if err != nil {
+			reject(c, storageErrorReason(err), err, "reporter_pubkey", report.Metadata.Pubkey)
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to store report"})
 			return
 		}
+		slog.InfoContext(ctx, "Stored report",
+			"reporter_name", report.Metadata.Name,
+			"reporter_pubkey", report.Metadata.Pubkey,
+			"devices", len(report.Data),
+			"rows", rows)
+		reportsAccepted.WithLabelValues("report").Inc()
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
@@ -224,47 +314,110 @@ func handleRepeaters(c *gin.Context) {
 	var request RepeaterRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
+		reject(c, "invalid_json", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON: " + err.Error()})
 		return
 	}
 
-	if err := validate.Struct(&request); err != nil {
+	ctx := c.Request.Context()
+	_, span := tracer.Start(ctx, "validate")
+	err := validate.Struct(&request)
+	endSpan(span, err)
+	if err != nil {
+		reject(c, "invalid", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	log.Printf("Received valid repeater data with %d repeaters\n", len(request.Data))
-
-	if err := insertRepeaterData(request); err != nil {
-		log.Printf("Error inserting repeater data: %v", err)
+	if err := insertRepeaterData(ctx, request); err != nil {
+		reject(c, storageErrorReason(err), err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to store repeater data"})
 		return
 	}
+	slog.InfoContext(ctx, "Stored repeaters", "rows", len(request.Data))
 
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
-func insertReportData(report ReportRequest) error {
-	ctx := context.Background()
+// reject counts a rejected ingestion request and logs why, with the reason
+// as the error category: a warning for invalid requests, an error when
+// storing failed.
+func reject(c *gin.Context, reason string, err error, args ...any) {
+	requestsRejected.WithLabelValues(c.FullPath(), reason).Inc()
+	c.Set("errorCategory", reason)
+
+	level := slog.LevelError
+	if reason == "invalid_json" || reason == "invalid" {
+		level = slog.LevelWarn
+	}
+	args = append(args, "error_category", reason, "error", err)
+	slog.Log(c.Request.Context(), level, "Rejected "+c.FullPath()+" request", args...)
+}
+
+func insertReportData(ctx context.Context, report ReportRequest) (rows int, err error) {
+	ctx, span := startInsert(ctx, "repeater_reports")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.ClickHouse.InsertTimeout))
+	defer cancel()
 
-	batch, err := db.PrepareBatch(ctx, "INSERT INTO repeater_reports")
+	batch, err := db.PrepareBatch(ctx, `
+		INSERT INTO repeater_reports (
+			timestamp,
+			repeater_name,
+			repeater_pubkey,
+			reporter_name,
+			reporter_pubkey,
+			radio_freq,
+			radio_bw,
+			radio_sf,
+			radio_cr,
+			radio_tx,
+			radio_preset,
+			band_plan,
+			compliance_status,
+			device_id,
+			device_name,
+			rssi,
+			snr,
+			latitude,
+			longitude,
+			geohash,
+			region_code,
+			district_code,
+			country_code,
+			subdivision_code,
+			locality_id,
+			scan_source,
+			ingested_at
+		)
+	`)
 	if err != nil {
-		return fmt.Errorf("failed to prepare batch: %w", err)
+		return 0, fmt.Errorf("failed to prepare batch: %w", err)
 	}
 
+	radioPreset := report.Metadata.Radio.Preset()
+	policy := report.Metadata.PrivacyPolicy()
+	var events []liveEvent
+
 	for _, device := range report.Data {
 		timestamp, err := parseTimestamp(device.Timestamp)
 		if err != nil {
-			return fmt.Errorf("failed to parse timestamp: %w", err)
+			return 0, fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+
+		position, ok := policy.Apply(device.Latitude, device.Longitude)
+		if !ok {
+			rowsDropped.WithLabelValues("home_zone").Inc()
+			continue
 		}
 
-		geoHash := geohash.EncodeWithPrecision(device.Latitude, device.Longitude, 8)
-		regionCode, districtCode, countryCode := geo.ReverseGeocode(device.Latitude, device.Longitude)
+		location := locate(ctx, position.Lat, position.Lon)
+		compliance := bandplan.Check(location.CountryCode, report.Metadata.Radio.Freq, report.Metadata.Radio.BW, report.Metadata.Radio.TX)
 
 		var lat, lon interface{}
-		if storePreciseLocation {
-			lat = device.Latitude
-			lon = device.Longitude
+		if storePreciseLocation && position.Precise {
+			lat = position.Lat
+			lon = position.Lon
 		} else {
 			lat = nil
 			lon = nil
@@ -281,36 +434,92 @@ func insertReportData(report ReportRequest) error {
 			report.Metadata.Radio.SF,
 			report.Metadata.Radio.CR,
 			report.Metadata.Radio.TX,
+			radioPreset,
+			compliance.Plan,
+			compliance.Status,
 			device.DeviceID,
 			device.DeviceName,
 			device.RSSI,
 			device.SNR,
 			lat,
 			lon,
-			geoHash,
-			regionCode,
-			districtCode,
-			countryCode,
+			position.Geohash,
+			location.RegionCode,
+			location.DistrictCode,
+			location.CountryCode,
+			location.SubdivisionCode,
+			location.LocalityID,
 			device.ScanSource,
 			time.Now(),
 		)
 
 		if err != nil {
-			return fmt.Errorf("failed to append to batch: %w", err)
+			return 0, fmt.Errorf("failed to append to batch: %w", err)
 		}
+		rows++
+
+		cellLat, cellLon := liveCell(position)
+		events = append(events, liveEvent{
+			name:     "report",
+			lat:      cellLat,
+			lon:      cellLon,
+			repeater: strings.ToLower(device.DeviceID),
+			preset:   radioPreset,
+			data: LiveReport{
+				Timestamp:      timestamp,
+				RepeaterPubkey: device.DeviceID,
+				RepeaterName:   device.DeviceName,
+				ReporterName:   report.Metadata.Name,
+				RSSI:           device.RSSI,
+				SNR:            device.SNR,
+				Preset:         radioPreset,
+				Geohash:        position.Geohash,
+				Lat:            cellLat,
+				Lon:            cellLon,
+			},
+		})
 	}
 
-	if err := batch.Send(); err != nil {
-		return fmt.Errorf("failed to send batch: %w", err)
+	if rows == 0 {
+		return 0, batch.Abort()
 	}
 
-	return nil
+	start := time.Now()
+	err = batch.Send()
+	observeInsert("repeater_reports", rows, start, err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send batch: %w", err)
+	}
+	lastReport.Set(float64(time.Now().Unix()))
+	live.publish(events...)
+
+	return rows, nil
 }
 
-func insertRepeaterData(request RepeaterRequest) error {
-	ctx := context.Background()
+func insertRepeaterData(ctx context.Context, request RepeaterRequest) (err error) {
+	ctx, span := startInsert(ctx, "repeaters")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.ClickHouse.InsertTimeout))
+	defer cancel()
 
-	batch, err := db.PrepareBatch(ctx, "INSERT INTO repeaters")
+	// Webhooks are told about new and moved repeaters once they are stored.
+	notifyChanges, err := notifyRepeaterChanges(ctx, request.Data)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error looking up repeaters for webhooks", "error", err)
+		notifyChanges = func() {}
+	}
+
+	batch, err := db.PrepareBatch(ctx, `
+		INSERT INTO repeaters (
+			public_key,
+			name,
+			lat,
+			lon,
+			antenna_height,
+			created_date,
+			updated_at
+		)
+	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare batch: %w", err)
 	}
@@ -323,6 +532,7 @@ func insertRepeaterData(request RepeaterRequest) error {
 			repeater.Name,
 			repeater.Lat,
 			repeater.Lon,
+			toFloat32Ptr(repeater.AntennaHeight),
 			now,
 			now,
 		)
@@ -332,38 +542,76 @@ func insertRepeaterData(request RepeaterRequest) error {
 		}
 	}
 
-	if err := batch.Send(); err != nil {
+	start := time.Now()
+	err = batch.Send()
+	observeInsert("repeaters", len(request.Data), start, err)
+	if err != nil {
 		return fmt.Errorf("failed to send batch: %w", err)
 	}
+	repeaterUpserts.Add(float64(len(request.Data)))
+	notifyChanges()
+
+	events := make([]liveEvent, 0, len(request.Data))
+	for _, repeater := range request.Data {
+		events = append(events, liveEvent{
+			name:     "repeater",
+			lat:      repeater.Lat,
+			lon:      repeater.Lon,
+			repeater: strings.ToLower(repeater.PublicKey),
+			data: LiveRepeater{
+				Timestamp: now,
+				PublicKey: repeater.PublicKey,
+				Name:      repeater.Name,
+				Lat:       repeater.Lat,
+				Lon:       repeater.Lon,
+			},
+		})
+	}
+	live.publish(events...)
 
 	return nil
 }
 
-func insertDeadZoneData(report ReportRequest) error {
-	ctx := context.Background()
+// insertDeadZoneData stores the dead zone and returns the geohash it was
+// stored at, or "" when a home zone dropped it.
+func insertDeadZoneData(ctx context.Context, report ReportRequest) (cell string, err error) {
+	ctx, span := startInsert(ctx, "dead_zones")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.ClickHouse.InsertTimeout))
+	defer cancel()
 
 	lat, err := parseCoordinate(report.Metadata.Latitude)
 	if err != nil {
-		return fmt.Errorf("invalid latitude: %w", err)
+		return "", fmt.Errorf("invalid latitude: %w", err)
 	}
 
 	lon, err := parseCoordinate(report.Metadata.Longitude)
 	if err != nil {
-		return fmt.Errorf("invalid longitude: %w", err)
+		return "", fmt.Errorf("invalid longitude: %w", err)
+	}
+
+	position, ok := report.Metadata.PrivacyPolicy().Apply(lat, lon)
+	if !ok {
+		rowsDropped.WithLabelValues("home_zone").Inc()
+		return "", nil
 	}
 
-	geoHash := geohash.EncodeWithPrecision(lat, lon, 8)
-	regionCode, districtCode, countryCode := geo.ReverseGeocode(lat, lon)
+	location := locate(ctx, position.Lat, position.Lon)
+	compliance := bandplan.Check(location.CountryCode, report.Metadata.Radio.Freq, report.Metadata.Radio.BW, report.Metadata.Radio.TX)
+
+	// Checked before the insert, which would otherwise be the earlier data.
+	firstInCell := isNewDeadZoneCell(ctx, position.Geohash)
 
 	var latitude, longitude interface{}
-	if storePreciseLocation {
-		latitude = lat
-		longitude = lon
+	if storePreciseLocation && position.Precise {
+		latitude = position.Lat
+		longitude = position.Lon
 	} else {
 		latitude = nil
 		longitude = nil
 	}
 
+	start := time.Now()
 	err = db.Exec(ctx, `
 		INSERT INTO dead_zones (
 			timestamp,
@@ -374,14 +622,19 @@ func insertDeadZoneData(report ReportRequest) error {
 			radio_sf,
 			radio_cr,
 			radio_tx,
+			radio_preset,
+			band_plan,
+			compliance_status,
 			latitude,
 			longitude,
 			geohash,
 			region_code,
 			district_code,
 			country_code,
+			subdivision_code,
+			locality_id,
 			ingested_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		time.Now(),
 		report.Metadata.Name,
@@ -391,20 +644,54 @@ func insertDeadZoneData(report ReportRequest) error {
 		report.Metadata.Radio.SF,
 		report.Metadata.Radio.CR,
 		report.Metadata.Radio.TX,
+		report.Metadata.Radio.Preset(),
+		compliance.Plan,
+		compliance.Status,
 		latitude,
 		longitude,
-		geoHash,
-		regionCode,
-		districtCode,
-		countryCode,
+		position.Geohash,
+		location.RegionCode,
+		location.DistrictCode,
+		location.CountryCode,
+		location.SubdivisionCode,
+		location.LocalityID,
 		time.Now(),
 	)
 
+	observeInsert("dead_zones", 1, start, err)
 	if err != nil {
-		return fmt.Errorf("failed to insert dead zone data: %w", err)
+		return "", fmt.Errorf("failed to insert dead zone data: %w", err)
+	}
+	lastReport.Set(float64(time.Now().Unix()))
+
+	cellLat, cellLon := liveCell(position)
+	if firstInCell {
+		notify(ctx, EventDeadZoneNew, webhookFilter{countryCode: location.CountryCode, subdivisionCode: location.SubdivisionCode}, WebhookDeadZone{
+			ReporterName:    report.Metadata.Name,
+			Preset:          report.Metadata.Radio.Preset(),
+			Geohash:         position.Geohash,
+			Lat:             cellLat,
+			Lon:             cellLon,
+			CountryCode:     location.CountryCode,
+			SubdivisionCode: location.SubdivisionCode,
+		})
 	}
+	live.publish(liveEvent{
+		name:   "dead_zone",
+		lat:    cellLat,
+		lon:    cellLon,
+		preset: report.Metadata.Radio.Preset(),
+		data: LiveDeadZone{
+			Timestamp:    time.Now(),
+			ReporterName: report.Metadata.Name,
+			Preset:       report.Metadata.Radio.Preset(),
+			Geohash:      position.Geohash,
+			Lat:          cellLat,
+			Lon:          cellLon,
+		},
+	})
 
-	return nil
+	return position.Geohash, nil
 }
 
 func parseCoordinate(coord string) (float64, error) {
@@ -416,6 +703,14 @@ func parseCoordinate(coord string) (float64, error) {
 	return f, nil
 }
 
+func toFloat32Ptr(v *float64) *float32 {
+	if v == nil {
+		return nil
+	}
+	f := float32(*v)
+	return &f
+}
+
 func parseTimestamp(ts string) (time.Time, error) {
 	validFormats := []string{
 		time.RFC3339,
@@ -432,12 +727,111 @@ func parseTimestamp(ts string) (time.Time, error) {
 }
 
 func main() {
-	router := gin.Default()
+	args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfig(args[1:]); err != nil {
+			fatal("Command failed", "command", "config", "error", err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] != "backfill" && args[0] != "migrate" {
+		fatal("Unknown command", "command", args[0])
+	}
+
+	if err := openDependencies(); err != nil {
+		fatal("Startup failed", "error", err)
+	}
+
+	switch {
+	case len(args) > 0 && args[0] == "backfill":
+		if err = runBackfill(args[1:]); err != nil {
+			err = fmt.Errorf("backfill failed: %w", err)
+		}
+	case len(args) > 0 && args[0] == "migrate":
+		if err = runMigrate(args[1:]); err != nil {
+			err = fmt.Errorf("migration failed: %w", err)
+		}
+	default:
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err = serve(ctx, cfg.Server.Addr)
+		stop()
+	}
+
+	if closeErr := db.Close(); closeErr != nil {
+		slog.Error("Error closing ClickHouse connection", "error", closeErr)
+	}
+	if err != nil {
+		fatal("Exiting", "error", err)
+	}
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// runConfig implements "config print", which writes the effective
+// configuration, with secrets redacted, in the config file format.
+func runConfig(args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New("usage: config print")
+	}
+
+	out, err := cfg.Redacted().YAML()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func newRouter() *gin.Engine {
+	router := gin.New()
 
 	router.HandleMethodNotAllowed = true
+	router.Use(traceRequests, logRequests, gin.CustomRecoveryWithWriter(io.Discard, recoverPanic), observeRequests)
+
+	router.GET("/healthz", handleHealthz)
+	router.GET("/readyz", handleReadyz)
+	router.GET("/version", handleVersion)
+	router.GET("/metrics", requireAdminToken, handleMetrics)
 
 	router.POST("/report", handleReport)
 	router.POST("/repeaters", handleRepeaters)
+	router.GET("/repeaters/:pubkey/coverage", handleCoverage)
+	router.GET("/repeaters/:pubkey/links", handleLinks)
+	router.GET("/repeaters/:pubkey/compliance", handleRepeaterCompliance)
+	router.GET("/live", handleLive)
+	router.GET("/los", handleLOS)
+	router.POST("/link-budget", handleLinkBudget)
+	router.GET("/presets", handlePresets)
+	router.GET("/geocode", handleGeocode)
+	router.GET("/geocode/nearby", handleGeocodeNearby)
+	router.GET("/places/search", handlePlaceSearch)
+	router.GET("/compliance", handleComplianceList)
+	router.GET("/compliance/:pubkey", handleCompliance)
+	router.GET("/stats/regions", handleRegionStats)
+
+	reporters := router.Group("/reporters/:pubkey", requireReporterSignature)
+	reporters.GET("/export", handleReporterExport)
+	reporters.POST("/erasure", handleReporterErasure)
+	reporters.GET("/erasure/:id", handleErasureStatus)
+
+	admin := router.Group("/admin", requireAdminToken)
+	admin.GET("/geocoder", handleGeocoderStatus)
+	admin.POST("/geocoder/reload", handleGeocoderReload)
+	admin.GET("/webhooks", handleListWebhooks)
+	admin.POST("/webhooks", handleCreateWebhook)
+	admin.DELETE("/webhooks/:id", handleDeleteWebhook)
+	admin.GET("/webhooks/:id/deliveries", handleWebhookDeliveries)
+	admin.POST("/webhooks/:id/ping", handlePingWebhook)
 
 	router.NoRoute(func(c *gin.Context) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Route not found"})
@@ -447,9 +841,5 @@ func main() {
 		c.JSON(http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 	})
 
-	port := "8080"
-	log.Printf("Server starting on port %s...\n", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal(err)
-	}
+	return router
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+
+	"meshcore-map-api/internal/geocoder"
+)
+
+var geocoderBuckets = []float64{.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01}
+
+var (
+	registry = prometheus.NewRegistry()
+	metrics  = promauto.With(registry)
+
+	reportsAccepted = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_reports_accepted_total",
+		Help: "Reports stored, by kind (report or dead_zone).",
+	}, []string{"kind"})
+	requestsRejected = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_ingest_rejected_total",
+		Help: "Ingestion requests rejected, by endpoint and reason (invalid_json, invalid, storage_error, timeout, canceled).",
+	}, []string{"endpoint", "reason"})
+	rowsInserted = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_rows_inserted_total",
+		Help: "Rows inserted into ClickHouse, by table.",
+	}, []string{"table"})
+	rowsDropped = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_rows_dropped_total",
+		Help: "Report rows not stored, by reason.",
+	}, []string{"reason"})
+	repeaterUpserts = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "meshcore_repeater_upserts_total",
+		Help: "Repeater rows upserted.",
+	})
+	lastReport = metrics.NewGauge(prometheus.GaugeOpts{
+		Name: "meshcore_last_report_timestamp_seconds",
+		Help: "Unix time of the last stored report or dead zone.",
+	})
+
+	requestDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "meshcore_http_request_duration_seconds",
+		Help: "HTTP request latency, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	batchDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "meshcore_clickhouse_insert_duration_seconds",
+		Help: "Time to send an insert to ClickHouse, by table.",
+	}, []string{"table"})
+	batchErrors = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_clickhouse_insert_errors_total",
+		Help: "Failed ClickHouse inserts, by table.",
+	}, []string{"table"})
+
+	geocoderDuration = metrics.NewHistogram(prometheus.HistogramOpts{
+		Name:    "meshcore_geocoder_lookup_duration_seconds",
+		Help:    "Reverse geocoding latency.",
+		Buckets: geocoderBuckets,
+	})
+	geocoderLookups = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_geocoder_lookups_total",
+		Help: "Reverse geocoding lookups, by result (hit when a country was found, miss otherwise).",
+	}, []string{"result"})
+
+	liveSubscribers = metrics.NewGauge(prometheus.GaugeOpts{
+		Name: "meshcore_live_subscribers",
+		Help: "Clients connected to GET /live.",
+	})
+	liveEvents = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_live_events_sent_total",
+		Help: "Events queued for live clients, by type.",
+	}, []string{"type"})
+	liveEventsDropped = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "meshcore_live_events_dropped_total",
+		Help: "Events not sent to live clients too slow to keep up.",
+	})
+
+	webhookAttempts = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_webhook_attempts_total",
+		Help: "Webhook delivery attempts, by result (delivered or failed).",
+	}, []string{"result"})
+	webhookDropped = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "meshcore_webhook_dropped_total",
+		Help: "Webhook notifications dropped because the delivery queue was full.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "meshcore_clickhouse_open_connections",
+		Help: "Open ClickHouse connections.",
+	}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		return float64(db.Stats().Open)
+	})
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "meshcore_clickhouse_idle_connections",
+		Help: "Idle ClickHouse connections.",
+	}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		return float64(db.Stats().Idle)
+	})
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "meshcore_clickhouse_max_open_connections",
+		Help: "Maximum open ClickHouse connections.",
+	}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		return float64(db.Stats().MaxOpenConns)
+	})
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "meshcore_geocoder_cities",
+		Help: "Cities loaded in the geocoder.",
+	}, func() float64 {
+		if geo == nil {
+			return 0
+		}
+		return float64(geo.Status().Cities)
+	})
+}
+
+// observeRequests records the latency of every request by route template, so
+// path parameters don't create a series per value.
+func observeRequests(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	requestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Observe(time.Since(start).Seconds())
+}
+
+var handleMetrics = gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+// locate reverse geocodes a point, recording latency and whether a country
+// was found.
+func locate(ctx context.Context, lat, lon float64) geocoder.Location {
+	_, span := tracer.Start(ctx, "geocode")
+	defer span.End()
+
+	start := time.Now()
+	location := geo.Locate(lat, lon)
+	geocoderDuration.Observe(time.Since(start).Seconds())
+	span.SetAttributes(attribute.String("geo.country.iso_code", location.CountryCode))
+
+	if location.CountryCode != "" {
+		geocoderLookups.WithLabelValues("hit").Inc()
+	} else {
+		geocoderLookups.WithLabelValues("miss").Inc()
+	}
+	return location
+}
+
+// storageErrorReason is the rejection reason of a failed insert: timeout when
+// it ran out of time, canceled when the client went away, storage_error
+// otherwise.
+func storageErrorReason(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "storage_error"
+	}
+}
+
+// observeInsert records the duration and outcome of a ClickHouse insert of
+// rows into table.
+func observeInsert(table string, rows int, start time.Time, err error) {
+	batchDuration.WithLabelValues(table).Observe(time.Since(start).Seconds())
+	if err != nil {
+		batchErrors.WithLabelValues(table).Inc()
+		return
+	}
+	rowsInserted.WithLabelValues(table).Add(float64(rows))
+}
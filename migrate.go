@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const migrationsTable = "schema_migrations"
+
+// runMigrate applies the SQL files in -dir not yet recorded in
+// schema_migrations, in file name order, then the configured retention.
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := flags.String("dir", filepath.Join("sql", "clickhouse"), "directory of numbered .sql files")
+	baseline := flags.String("baseline", "", "record files up to and including this one (e.g. 004) as applied without running them, if the schema was set up by hand")
+	flags.Parse(args)
+
+	ctx := context.Background()
+
+	if cfg.ClickHouse.Cluster != "" {
+		slog.Info("Migrating cluster", "cluster", cfg.ClickHouse.Cluster)
+	}
+
+	// A baseline only describes a schema set up by hand, so it is ignored on
+	// an empty database and once migrate manages the schema. Deployments can
+	// pass it every time.
+	if *baseline != "" {
+		var managed, existing bool
+		err := db.QueryRow(ctx, `
+			SELECT countIf(name = ?) > 0, countIf(name = 'repeater_reports') > 0
+			FROM system.tables
+			WHERE database = currentDatabase()
+		`, migrationsTable).Scan(&managed, &existing)
+		if err != nil {
+			return fmt.Errorf("failed to query tables: %w", err)
+		}
+		if managed || !existing {
+			slog.Info("Ignoring baseline", "baseline", *baseline, "managed", managed)
+			*baseline = ""
+		}
+	}
+
+	err := db.Exec(ctx, clusterStatement(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			version String,
+			applied_at DateTime DEFAULT now()
+		) ENGINE = ReplacingMergeTree(applied_at)
+		ORDER BY version`, migrationsTable)))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", migrationsTable, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(*dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	applied, err := getAppliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		version := strings.TrimSuffix(filepath.Base(file), ".sql")
+		if applied[version] {
+			continue
+		}
+
+		if number, _, _ := strings.Cut(version, "_"); *baseline != "" && number <= *baseline {
+			slog.Info("Recording migration as applied", "version", version)
+		} else {
+			start := time.Now()
+			if err := applyMigration(ctx, file); err != nil {
+				return fmt.Errorf("%s: %w", version, err)
+			}
+			slog.Info("Applied migration", "version", version, "duration_ms", time.Since(start).Milliseconds())
+		}
+
+		if err := db.Exec(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", migrationsTable), version); err != nil {
+			return fmt.Errorf("failed to record %s: %w", version, err)
+		}
+	}
+
+	if err := applyRetention(ctx, rawRetentionDays); err != nil {
+		return err
+	}
+
+	slog.Info("Migrations complete")
+	return nil
+}
+
+func getAppliedMigrations(ctx context.Context) (map[string]bool, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf("SELECT version FROM %s", migrationsTable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", migrationsTable, err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration runs the statements of a file in order. They run in a
+// mutation context, so a mutation has finished before the next statement and
+// may use subqueries.
+func applyMigration(ctx context.Context, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range splitStatements(string(data)) {
+		if err := db.Exec(mutationContext(ctx), clusterStatement(stmt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a migration file into statements on the semicolons
+// ending them, dropping "--" comment lines. Semicolons inside string literals
+// are not supported.
+func splitStatements(sql string) []string {
+	var lines []string
+	for _, line := range strings.Split(sql, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var statements []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
+
+var (
+	ddlPattern    = regexp.MustCompile(`(?is)^((?:CREATE\s+(?:TABLE|MATERIALIZED\s+VIEW)|ALTER\s+TABLE)\s+(?:IF\s+NOT\s+EXISTS\s+)?[\w.]+)`)
+	enginePattern = regexp.MustCompile(`(?i)ENGINE\s*=\s*(\w*)MergeTree\(\s*([^)]*?)\s*\)`)
+)
+
+// clusterStatement adapts a migration statement written for a single server
+// to the configured cluster, if any: DDL runs ON CLUSTER and MergeTree
+// engines become their Replicated variants. Other statements, like the
+// INSERTs filling new tables, run on one replica and are replicated.
+func clusterStatement(stmt string) string {
+	c := cfg.ClickHouse
+	if c.Cluster == "" {
+		return stmt
+	}
+
+	stmt = ddlPattern.ReplaceAllString(stmt, fmt.Sprintf("${1} ON CLUSTER '%s'", c.Cluster))
+	return enginePattern.ReplaceAllStringFunc(stmt, func(engine string) string {
+		m := enginePattern.FindStringSubmatch(engine)
+		if strings.HasPrefix(m[1], "Replicated") {
+			return engine
+		}
+		args := fmt.Sprintf("'%s', '%s'", c.ReplicaPath, c.ReplicaName)
+		if m[2] != "" {
+			args += ", " + m[2]
+		}
+		return fmt.Sprintf("ENGINE = Replicated%sMergeTree(%s)", m[1], args)
+	})
+}
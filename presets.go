@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"meshcore-map-api/internal/lora"
+)
+
+func handlePresets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"presets": lora.Presets})
+}
+
+func repeaterReportsFilter(pubkey, preset string) (string, []any) {
+	where := "repeater_pubkey = ?"
+	args := []any{pubkey}
+
+	if preset != "" {
+		where += " AND radio_preset = ?"
+		args = append(args, preset)
+	}
+
+	return where, args
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxSignatureAge = 5 * time.Minute
+
+	ErasurePending = "pending"
+	ErasureRunning = "running"
+	ErasureDone    = "done"
+	ErasureFailed  = "failed"
+)
+
+// Tables holding rows keyed by reporter_pubkey, including the daily
+// aggregates kept after the raw rows expire. repeater_reports_hourly only
+// aggregates per repeater and holds nothing about the reporter.
+var reporterTables = []string{"repeater_reports", "dead_zones", "repeater_reports_daily", "dead_zones_daily"}
+
+type ExportQuery struct {
+	Format string `form:"format" validate:"omitempty,oneof=json csv"`
+}
+
+type ExportRecord struct {
+	Type             string    `json:"type"`
+	Timestamp        time.Time `json:"timestamp"`
+	ReporterName     string    `json:"reporterName"`
+	RepeaterName     string    `json:"repeaterName,omitempty"`
+	RepeaterPubkey   string    `json:"repeaterPubkey,omitempty"`
+	Radio            RadioInfo `json:"radio"`
+	RadioPreset      string    `json:"radioPreset"`
+	BandPlan         string    `json:"bandPlan"`
+	ComplianceStatus string    `json:"complianceStatus"`
+	DeviceID         string    `json:"deviceId,omitempty"`
+	DeviceName       string    `json:"deviceName,omitempty"`
+	RSSI             *int16    `json:"rssi,omitempty"`
+	SNR              *float32  `json:"snr,omitempty"`
+	Latitude         *float64  `json:"latitude"`
+	Longitude        *float64  `json:"longitude"`
+	Geohash          string    `json:"geohash"`
+	RegionCode       string    `json:"regionCode"`
+	DistrictCode     string    `json:"districtCode"`
+	CountryCode      string    `json:"countryCode"`
+	SubdivisionCode  string    `json:"subdivisionCode"`
+	LocalityID       uint32    `json:"localityId"`
+	ScanSource       string    `json:"scanSource,omitempty"`
+	IngestedAt       time.Time `json:"ingestedAt"`
+}
+
+var exportCSVHeader = []string{
+	"type", "timestamp", "reporterName", "repeaterName", "repeaterPubkey",
+	"freq", "bw", "sf", "cr", "tx", "radioPreset", "bandPlan", "complianceStatus",
+	"deviceId", "deviceName", "rssi", "snr", "latitude", "longitude", "geohash",
+	"regionCode", "districtCode", "countryCode", "subdivisionCode", "localityId",
+	"scanSource", "ingestedAt",
+}
+
+type ErasureJob struct {
+	ID          uuid.UUID `json:"id"`
+	Pubkey      string    `json:"pubkey"`
+	Status      string    `json:"status"`
+	Rows        uint64    `json:"rows"`
+	Error       string    `json:"error,omitempty"`
+	RequestedAt time.Time `json:"requestedAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// requireReporterSignature checks that the caller holds the private key of
+// the reporter in the path: X-Signature is the hex Ed25519 signature of
+// "<method> <path> <X-Timestamp>", with X-Timestamp in Unix seconds.
+func requireReporterSignature(c *gin.Context) {
+	pubkey := strings.ToLower(c.Param("pubkey"))
+	if err := validate.Var(pubkey, "len=64,hexadecimal"); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid public key"})
+		return
+	}
+
+	err := verifyReporterSignature(pubkey, c.Request.Method, c.Request.URL.Path,
+		c.GetHeader("X-Timestamp"), c.GetHeader("X-Signature"), time.Now())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized: " + err.Error()})
+		return
+	}
+
+	c.Set("pubkey", pubkey)
+	c.Next()
+}
+
+func verifyReporterSignature(pubkey, method, path, timestamp, signature string, now time.Time) error {
+	key, err := hex.DecodeString(pubkey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid X-Timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return errors.New("X-Timestamp is too far from the server time")
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("missing or invalid X-Signature")
+	}
+
+	message := method + " " + path + " " + timestamp
+	if !ed25519.Verify(key, []byte(message), sig) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+func handleReporterExport(c *gin.Context) {
+	pubkey := c.GetString("pubkey")
+
+	var query ExportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	format := query.Format
+	if format == "" {
+		format = "json"
+	}
+
+	rows, err := queryReporterData(pubkey)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error exporting reporter data", "reporter_pubkey", pubkey, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export data"})
+		return
+	}
+	defer rows.Close()
+
+	// A large export can take longer than the server's write timeout.
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="meshcore-%s.%s"`, pubkey[:16], format))
+
+	// Rows are streamed, so an error after the first one can only be logged
+	// and the response ends truncated.
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		err = writeExportCSV(c.Writer, rows)
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		err = writeExportJSON(c.Writer, pubkey, rows)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error exporting reporter data", "reporter_pubkey", pubkey, "error", err)
+	}
+}
+
+type exportRows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+func writeExportJSON(w io.Writer, pubkey string, rows exportRows) error {
+	header, _ := json.Marshal(gin.H{"pubkey": pubkey, "exportedAt": time.Now().UTC()})
+	// Open the header object and add the records array to it.
+	fmt.Fprintf(w, "%s,\"records\":[", header[:len(header)-1])
+
+	for i := 0; rows.Next(); i++ {
+		record, err := scanExportRecord(rows)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			w.Write([]byte{','})
+		}
+		w.Write(b)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err := w.Write([]byte("]}\n"))
+	return err
+}
+
+func writeExportCSV(w io.Writer, rows exportRows) error {
+	cw := csv.NewWriter(w)
+	cw.Write(exportCSVHeader)
+
+	for rows.Next() {
+		r, err := scanExportRecord(rows)
+		if err != nil {
+			return err
+		}
+		cw.Write([]string{
+			r.Type,
+			r.Timestamp.Format(time.RFC3339Nano),
+			r.ReporterName,
+			r.RepeaterName,
+			r.RepeaterPubkey,
+			strconv.FormatFloat(r.Radio.Freq, 'f', -1, 32),
+			strconv.FormatFloat(r.Radio.BW, 'f', -1, 32),
+			strconv.Itoa(r.Radio.SF),
+			strconv.Itoa(r.Radio.CR),
+			strconv.Itoa(r.Radio.TX),
+			r.RadioPreset,
+			r.BandPlan,
+			r.ComplianceStatus,
+			r.DeviceID,
+			r.DeviceName,
+			csvValue(r.RSSI, func(v int16) string { return strconv.Itoa(int(v)) }),
+			csvValue(r.SNR, func(v float32) string { return strconv.FormatFloat(float64(v), 'f', -1, 32) }),
+			csvValue(r.Latitude, func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }),
+			csvValue(r.Longitude, func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }),
+			r.Geohash,
+			r.RegionCode,
+			r.DistrictCode,
+			r.CountryCode,
+			r.SubdivisionCode,
+			strconv.FormatUint(uint64(r.LocalityID), 10),
+			r.ScanSource,
+			r.IngestedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue[T any](v *T, format func(T) string) string {
+	if v == nil {
+		return ""
+	}
+	return format(*v)
+}
+
+func queryReporterData(pubkey string) (exportRows, error) {
+	ctx := context.Background()
+
+	rows, err := db.Query(ctx, `
+		SELECT *
+		FROM (
+			SELECT
+				'report' AS type, timestamp, reporter_name, repeater_name, toString(repeater_pubkey) AS repeater_pubkey,
+				radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, radio_preset, band_plan, compliance_status,
+				device_id, device_name, CAST(rssi, 'Nullable(Int16)') AS rssi, CAST(snr, 'Nullable(Float32)') AS snr,
+				latitude, longitude, geohash, toString(region_code) AS region_code, toString(district_code) AS district_code,
+				toString(country_code) AS country_code, subdivision_code, locality_id, scan_source, ingested_at
+			FROM repeater_reports
+			WHERE lower(toString(reporter_pubkey)) = ?
+			UNION ALL
+			SELECT
+				'dead_zone', timestamp, reporter_name, '', '',
+				radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, radio_preset, band_plan, compliance_status,
+				device_id, device_name, NULL, NULL,
+				latitude, longitude, geohash, toString(region_code), toString(district_code),
+				toString(country_code), subdivision_code, locality_id, scan_source, ingested_at
+			FROM dead_zones
+			WHERE lower(toString(reporter_pubkey)) = ?
+		)
+		ORDER BY timestamp
+	`, pubkey, pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reporter data: %w", err)
+	}
+	return rows, nil
+}
+
+func scanExportRecord(rows exportRows) (ExportRecord, error) {
+	var r ExportRecord
+	var freq, bw float32
+	var sf, cr, tx uint8
+	err := rows.Scan(
+		&r.Type, &r.Timestamp, &r.ReporterName, &r.RepeaterName, &r.RepeaterPubkey,
+		&freq, &bw, &sf, &cr, &tx, &r.RadioPreset, &r.BandPlan, &r.ComplianceStatus,
+		&r.DeviceID, &r.DeviceName, &r.RSSI, &r.SNR,
+		&r.Latitude, &r.Longitude, &r.Geohash, &r.RegionCode, &r.DistrictCode,
+		&r.CountryCode, &r.SubdivisionCode, &r.LocalityID, &r.ScanSource, &r.IngestedAt,
+	)
+	if err != nil {
+		return r, fmt.Errorf("failed to scan reporter data: %w", err)
+	}
+
+	r.RepeaterPubkey = strings.TrimRight(r.RepeaterPubkey, "\x00")
+	r.RegionCode = strings.TrimRight(r.RegionCode, "\x00")
+	r.DistrictCode = strings.TrimRight(r.DistrictCode, "\x00")
+	r.CountryCode = strings.TrimRight(r.CountryCode, "\x00")
+	r.Radio = RadioInfo{Freq: float64(freq), BW: float64(bw), SF: int(sf), CR: int(cr), TX: int(tx)}
+	return r, nil
+}
+
+// handleReporterErasure starts deleting every row stored for the reporter
+// and returns the job, or the job already in progress.
+func handleReporterErasure(c *gin.Context) {
+	pubkey := c.GetString("pubkey")
+
+	job, err := getActiveErasureJob(pubkey)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading erasure jobs", "reporter_pubkey", pubkey, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start erasure"})
+		return
+	}
+	if job != nil {
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	now := time.Now().UTC()
+	job = &ErasureJob{ID: uuid.New(), Pubkey: pubkey, Status: ErasurePending, RequestedAt: now, UpdatedAt: now}
+	if err := saveErasureJob(job); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving erasure job", "reporter_pubkey", pubkey, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start erasure"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Erasure requested", "job_id", job.ID, "reporter_pubkey", pubkey)
+	background.Go(func() { runErasureJob(*job) })
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func handleErasureStatus(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid job ID"})
+		return
+	}
+
+	job, err := getErasureJob(id, c.GetString("pubkey"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Erasure job not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading erasure job", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load erasure job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// runErasureJob deletes the reporter's rows with lightweight deletes, which
+// hide them immediately and drop them from disk on the next merges.
+func runErasureJob(job ErasureJob) {
+	ctx := context.Background()
+
+	update := func(status string, jobErr error) {
+		job.Status = status
+		job.UpdatedAt = time.Now().UTC()
+		if jobErr != nil {
+			job.Error = jobErr.Error()
+		}
+		if err := saveErasureJob(&job); err != nil {
+			slog.Error("Error saving erasure job", "job_id", job.ID, "error", err)
+		}
+	}
+
+	update(ErasureRunning, nil)
+
+	for _, table := range reporterTables {
+		var rows uint64
+		err := db.QueryRow(ctx, fmt.Sprintf(`SELECT count() FROM %s WHERE lower(toString(reporter_pubkey)) = ?`, table), job.Pubkey).Scan(&rows)
+		if err == nil && rows > 0 {
+			err = db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE lower(toString(reporter_pubkey)) = ?`, table), job.Pubkey)
+		}
+		if err != nil {
+			slog.Error("Erasure failed", "job_id", job.ID, "table", table, "error", err)
+			update(ErasureFailed, fmt.Errorf("failed to delete from %s", table))
+			return
+		}
+		job.Rows += rows
+	}
+
+	update(ErasureDone, nil)
+	slog.Info("Erasure done", "job_id", job.ID, "rows", job.Rows)
+}
+
+// resumeErasureJobs restarts jobs interrupted by a restart. Deleting again is
+// harmless, so they run from the start.
+func resumeErasureJobs() {
+	ctx := context.Background()
+
+	rows, err := db.Query(ctx, `
+		SELECT id, reporter_pubkey, status, rows, error, requested_at, updated_at
+		FROM erasure_jobs FINAL
+		WHERE status IN (?, ?)
+	`, ErasurePending, ErasureRunning)
+	if err != nil {
+		slog.Error("Error loading erasure jobs", "error", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var job ErasureJob
+		if err := rows.Scan(&job.ID, &job.Pubkey, &job.Status, &job.Rows, &job.Error, &job.RequestedAt, &job.UpdatedAt); err != nil {
+			slog.Error("Error scanning erasure job", "error", err)
+			return
+		}
+		slog.Info("Resuming erasure", "job_id", job.ID, "reporter_pubkey", job.Pubkey)
+		job.Rows = 0
+		background.Go(func() { runErasureJob(job) })
+	}
+}
+
+func saveErasureJob(job *ErasureJob) error {
+	ctx := context.Background()
+
+	err := db.Exec(ctx, `
+		INSERT INTO erasure_jobs (id, reporter_pubkey, status, rows, error, requested_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.Pubkey, job.Status, job.Rows, job.Error, job.RequestedAt, job.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert erasure job: %w", err)
+	}
+	return nil
+}
+
+func getErasureJob(id uuid.UUID, pubkey string) (*ErasureJob, error) {
+	ctx := context.Background()
+
+	var job ErasureJob
+	err := db.QueryRow(ctx, `
+		SELECT id, reporter_pubkey, status, rows, error, requested_at, updated_at
+		FROM erasure_jobs FINAL
+		WHERE id = ? AND reporter_pubkey = ?
+	`, id, pubkey).Scan(&job.ID, &job.Pubkey, &job.Status, &job.Rows, &job.Error, &job.RequestedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func getActiveErasureJob(pubkey string) (*ErasureJob, error) {
+	ctx := context.Background()
+
+	var job ErasureJob
+	err := db.QueryRow(ctx, `
+		SELECT id, reporter_pubkey, status, rows, error, requested_at, updated_at
+		FROM erasure_jobs FINAL
+		WHERE reporter_pubkey = ? AND status IN (?, ?)
+		ORDER BY requested_at DESC
+		LIMIT 1
+	`, pubkey, ErasurePending, ErasureRunning).Scan(&job.ID, &job.Pubkey, &job.Status, &job.Rows, &job.Error, &job.RequestedAt, &job.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query erasure jobs: %w", err)
+	}
+	return &job, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// rawRetentionDays is how long raw reports and dead zones are kept; 0 keeps
+// them forever. Older data is only available from the daily aggregates.
+var rawRetentionDays int
+
+var retentionTables = []string{"repeater_reports", "dead_zones"}
+
+// rawDataCutoff is the start of the first day whose raw rows are all still
+// stored. Reads use raw rows from the cutoff on and the daily aggregates
+// before it, so no day is counted twice or read from a partly expired day.
+func rawDataCutoff(now time.Time) time.Time {
+	if rawRetentionDays <= 0 {
+		return time.Unix(0, 0).UTC()
+	}
+	oldest := now.UTC().AddDate(0, 0, -rawRetentionDays)
+	return oldest.Truncate(24*time.Hour).AddDate(0, 0, 1)
+}
+
+// applyRetention sets the TTL of the raw tables to the retention, if it
+// differs. Shortening it deletes rows, so the daily aggregates must be in
+// place first.
+func applyRetention(ctx context.Context, days int) error {
+	for _, table := range retentionTables {
+		var engine string
+		err := db.QueryRow(ctx, `
+			SELECT engine_full
+			FROM system.tables
+			WHERE database = currentDatabase() AND name = ?
+		`, table).Scan(&engine)
+		if err != nil {
+			return fmt.Errorf("failed to read the TTL of %s: %w", table, err)
+		}
+
+		var stmt string
+		switch {
+		case days > 0 && !strings.Contains(engine, fmt.Sprintf("TTL timestamp + toIntervalDay(%d)", days)):
+			stmt = fmt.Sprintf("ALTER TABLE %s MODIFY TTL timestamp + INTERVAL %d DAY", table, days)
+		case days <= 0 && strings.Contains(engine, " TTL "):
+			stmt = fmt.Sprintf("ALTER TABLE %s REMOVE TTL", table)
+		default:
+			continue
+		}
+
+		slog.Info("Setting the retention", "table", table, "statement", stmt)
+		if err := db.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to set the retention of %s: %w", table, err)
+		}
+	}
+	return nil
+}
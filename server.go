@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+// background tracks goroutines, like erasure jobs, that outlive the request
+// starting them and are waited for on shutdown.
+var background sync.WaitGroup
+
+// serve runs the HTTP server until ctx is cancelled, then stops accepting
+// connections and waits for in-flight requests, so reports being stored
+// when the server is stopped are not lost.
+func serve(ctx context.Context, addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newRouter(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+	}
+	// Live streams never finish on their own.
+	server.RegisterOnShutdown(live.close)
+
+	stopTracing, err := startTracing(ctx)
+	if err != nil {
+		return err
+	}
+
+	go reloadGeocoderOnSignal()
+	resumeErasureJobs()
+	stopWebhooks := startWebhooks(ctx)
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "addr", addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Shutdown timed out, closing remaining connections", "error", err)
+		server.Close()
+	}
+	stopWebhooks(shutdownCtx)
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		slog.Warn("Background jobs still running, they resume on the next start")
+	}
+
+	// Export the spans still buffered, including those of the last requests.
+	if err := stopTracing(shutdownCtx); err != nil {
+		slog.Warn("Error flushing traces", "error", err)
+	}
+
+	slog.Info("Server stopped")
+	return nil
+}
@@ -40,4 +40,4 @@ TTL timestamp + INTERVAL 365 DAY
 SETTINGS index_granularity = 8192;
 
 ALTER TABLE repeater_reports 
-    ADD INDEX idx_geohash geohash TYPE bloom_filter GRANULARITY 4;
+    ADD INDEX IF NOT EXISTS idx_geohash geohash TYPE bloom_filter GRANULARITY 4;
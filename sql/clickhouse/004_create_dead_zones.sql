@@ -34,4 +34,4 @@ TTL timestamp + INTERVAL 365 DAY
 SETTINGS index_granularity = 8192;
 
 ALTER TABLE dead_zones 
-    ADD INDEX idx_geohash geohash TYPE bloom_filter GRANULARITY 4;
\ No newline at end of file
+    ADD INDEX IF NOT EXISTS idx_geohash geohash TYPE bloom_filter GRANULARITY 4;
\ No newline at end of file
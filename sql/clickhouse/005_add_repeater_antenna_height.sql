@@ -0,0 +1,2 @@
+ALTER TABLE repeaters
+    ADD COLUMN IF NOT EXISTS antenna_height Nullable(Float32) CODEC(ZSTD(1)) AFTER lon;
@@ -0,0 +1,7 @@
+-- Rows stored before this migration are left with an empty preset; run
+-- `./server backfill` to classify them from their radio settings.
+ALTER TABLE repeater_reports
+    ADD COLUMN IF NOT EXISTS radio_preset LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)) AFTER radio_tx;
+
+ALTER TABLE dead_zones
+    ADD COLUMN IF NOT EXISTS radio_preset LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)) AFTER radio_tx;
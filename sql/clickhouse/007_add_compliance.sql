@@ -0,0 +1,7 @@
+ALTER TABLE repeater_reports
+    ADD COLUMN IF NOT EXISTS band_plan LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)) AFTER radio_preset,
+    ADD COLUMN IF NOT EXISTS compliance_status LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)) AFTER band_plan;
+
+ALTER TABLE dead_zones
+    ADD COLUMN IF NOT EXISTS band_plan LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)) AFTER radio_preset,
+    ADD COLUMN IF NOT EXISTS compliance_status LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)) AFTER band_plan;
@@ -0,0 +1,7 @@
+ALTER TABLE repeater_reports
+    ADD COLUMN IF NOT EXISTS subdivision_code LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)) AFTER country_code,
+    ADD COLUMN IF NOT EXISTS locality_id UInt32 DEFAULT 0 CODEC(ZSTD(1)) AFTER subdivision_code;
+
+ALTER TABLE dead_zones
+    ADD COLUMN IF NOT EXISTS subdivision_code LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)) AFTER country_code,
+    ADD COLUMN IF NOT EXISTS locality_id UInt32 DEFAULT 0 CODEC(ZSTD(1)) AFTER subdivision_code;
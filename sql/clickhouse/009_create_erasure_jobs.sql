@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS erasure_jobs
+(
+    id UUID,
+    reporter_pubkey String CODEC(ZSTD(1)),
+    status LowCardinality(String) CODEC(ZSTD(1)),
+    rows UInt64 DEFAULT 0,
+    error String DEFAULT '' CODEC(ZSTD(1)),
+    requested_at DateTime64(3, 'UTC') CODEC(Delta, ZSTD(1)),
+    updated_at DateTime64(3, 'UTC') CODEC(Delta, ZSTD(1))
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id
+SETTINGS index_granularity = 8192;
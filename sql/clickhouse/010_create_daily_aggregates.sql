@@ -0,0 +1,153 @@
+-- Per day and geohash aggregates of reports and dead zones, kept after the
+-- raw rows expire. 013 keys them by reporter, so they can be erased, and
+-- drops the position sums.
+CREATE TABLE IF NOT EXISTS repeater_reports_daily
+(
+    day Date CODEC(Delta, ZSTD(1)),
+    repeater_pubkey FixedString(64) CODEC(ZSTD(1)),
+    geohash String CODEC(ZSTD(1)),
+    radio_preset LowCardinality(String) CODEC(ZSTD(1)),
+    radio_freq Float32 CODEC(ZSTD(1)),
+    radio_bw Float32 CODEC(ZSTD(1)),
+    radio_sf UInt8 CODEC(ZSTD(1)),
+    radio_cr UInt8 CODEC(ZSTD(1)),
+    radio_tx UInt8 CODEC(ZSTD(1)),
+
+    repeater_name SimpleAggregateFunction(anyLast, String) CODEC(ZSTD(1)),
+    region_code SimpleAggregateFunction(anyLast, String) CODEC(ZSTD(1)),
+    district_code SimpleAggregateFunction(anyLast, String) CODEC(ZSTD(1)),
+    country_code SimpleAggregateFunction(anyLast, String) CODEC(ZSTD(1)),
+
+    reports SimpleAggregateFunction(sum, UInt64) CODEC(ZSTD(1)),
+    rssi_sum SimpleAggregateFunction(sum, Int64) CODEC(ZSTD(1)),
+    rssi_min SimpleAggregateFunction(min, Int16) CODEC(ZSTD(1)),
+    rssi_max SimpleAggregateFunction(max, Int16) CODEC(ZSTD(1)),
+    snr_sum SimpleAggregateFunction(sum, Float64) CODEC(ZSTD(1)),
+
+    -- Reports stored with a precise position, and the sums of those positions.
+    located SimpleAggregateFunction(sum, UInt64) CODEC(ZSTD(1)),
+    latitude_sum SimpleAggregateFunction(sum, Float64) CODEC(ZSTD(1)),
+    longitude_sum SimpleAggregateFunction(sum, Float64) CODEC(ZSTD(1)),
+
+    reporters AggregateFunction(uniq, String),
+    last_seen SimpleAggregateFunction(max, DateTime64(6, 'UTC')) CODEC(ZSTD(1))
+)
+ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(day)
+ORDER BY (repeater_pubkey, day, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx)
+SETTINGS index_granularity = 8192;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS repeater_reports_daily_mv TO repeater_reports_daily AS
+SELECT
+    toDate(timestamp) AS day,
+    repeater_pubkey,
+    geohash,
+    radio_preset,
+    radio_freq,
+    radio_bw,
+    radio_sf,
+    radio_cr,
+    radio_tx,
+    anyLast(repeater_name) AS repeater_name,
+    anyLast(toString(region_code)) AS region_code,
+    anyLast(toString(district_code)) AS district_code,
+    anyLast(toString(country_code)) AS country_code,
+    count() AS reports,
+    sum(toInt64(rssi)) AS rssi_sum,
+    min(rssi) AS rssi_min,
+    max(rssi) AS rssi_max,
+    sum(toFloat64(snr)) AS snr_sum,
+    countIf(latitude IS NOT NULL AND longitude IS NOT NULL) AS located,
+    sum(ifNull(latitude, 0)) AS latitude_sum,
+    sum(ifNull(longitude, 0)) AS longitude_sum,
+    uniqState(toString(reporter_pubkey)) AS reporters,
+    max(timestamp) AS last_seen
+FROM repeater_reports
+GROUP BY day, repeater_pubkey, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx;
+
+-- Rows ingested before the view existed. Run once: running it again counts
+-- them twice.
+INSERT INTO repeater_reports_daily
+SELECT
+    toDate(timestamp) AS day,
+    repeater_pubkey,
+    geohash,
+    radio_preset,
+    radio_freq,
+    radio_bw,
+    radio_sf,
+    radio_cr,
+    radio_tx,
+    anyLast(repeater_name) AS repeater_name,
+    anyLast(toString(region_code)) AS region_code,
+    anyLast(toString(district_code)) AS district_code,
+    anyLast(toString(country_code)) AS country_code,
+    count() AS reports,
+    sum(toInt64(rssi)) AS rssi_sum,
+    min(rssi) AS rssi_min,
+    max(rssi) AS rssi_max,
+    sum(toFloat64(snr)) AS snr_sum,
+    countIf(latitude IS NOT NULL AND longitude IS NOT NULL) AS located,
+    sum(ifNull(latitude, 0)) AS latitude_sum,
+    sum(ifNull(longitude, 0)) AS longitude_sum,
+    uniqState(toString(reporter_pubkey)) AS reporters,
+    max(timestamp) AS last_seen
+FROM repeater_reports
+WHERE ingested_at < (
+    SELECT metadata_modification_time
+    FROM system.tables
+    WHERE database = currentDatabase() AND name = 'repeater_reports_daily_mv'
+)
+GROUP BY day, repeater_pubkey, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx;
+
+CREATE TABLE IF NOT EXISTS dead_zones_daily
+(
+    day Date CODEC(Delta, ZSTD(1)),
+    geohash String CODEC(ZSTD(1)),
+    radio_preset LowCardinality(String) CODEC(ZSTD(1)),
+
+    region_code SimpleAggregateFunction(anyLast, String) CODEC(ZSTD(1)),
+    district_code SimpleAggregateFunction(anyLast, String) CODEC(ZSTD(1)),
+    country_code SimpleAggregateFunction(anyLast, String) CODEC(ZSTD(1)),
+
+    scans SimpleAggregateFunction(sum, UInt64) CODEC(ZSTD(1)),
+    reporters AggregateFunction(uniq, String),
+    last_seen SimpleAggregateFunction(max, DateTime64(6, 'UTC')) CODEC(ZSTD(1))
+)
+ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(day)
+ORDER BY (day, geohash, radio_preset)
+SETTINGS index_granularity = 8192;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS dead_zones_daily_mv TO dead_zones_daily AS
+SELECT
+    toDate(timestamp) AS day,
+    geohash,
+    radio_preset,
+    anyLast(toString(region_code)) AS region_code,
+    anyLast(toString(district_code)) AS district_code,
+    anyLast(toString(country_code)) AS country_code,
+    count() AS scans,
+    uniqState(toString(reporter_pubkey)) AS reporters,
+    max(timestamp) AS last_seen
+FROM dead_zones
+GROUP BY day, geohash, radio_preset;
+
+INSERT INTO dead_zones_daily
+SELECT
+    toDate(timestamp) AS day,
+    geohash,
+    radio_preset,
+    anyLast(toString(region_code)) AS region_code,
+    anyLast(toString(district_code)) AS district_code,
+    anyLast(toString(country_code)) AS country_code,
+    count() AS scans,
+    uniqState(toString(reporter_pubkey)) AS reporters,
+    max(timestamp) AS last_seen
+FROM dead_zones
+WHERE ingested_at < (
+    SELECT metadata_modification_time
+    FROM system.tables
+    WHERE database = currentDatabase() AND name = 'dead_zones_daily_mv'
+)
+GROUP BY day, geohash, radio_preset;
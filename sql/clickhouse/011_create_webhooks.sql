@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id UUID,
+    url String CODEC(ZSTD(1)),
+    secret String CODEC(ZSTD(1)),
+    events Array(LowCardinality(String)),
+    regions Array(String),
+    repeaters Array(String),
+    silence_hours UInt16 DEFAULT 0,
+    deleted Bool DEFAULT false,
+    created_at DateTime64(3, 'UTC') CODEC(Delta, ZSTD(1)),
+    updated_at DateTime64(3, 'UTC') CODEC(Delta, ZSTD(1))
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id UUID,
+    webhook_id UUID,
+    event LowCardinality(String) CODEC(ZSTD(1)),
+    attempt UInt8,
+    status_code UInt16,
+    error String DEFAULT '' CODEC(ZSTD(1)),
+    duration_ms UInt32,
+    delivered Bool,
+    attempted_at DateTime64(3, 'UTC') CODEC(Delta, ZSTD(1))
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(attempted_at)
+ORDER BY (webhook_id, attempted_at)
+TTL toDateTime(attempted_at) + INTERVAL 30 DAY
+SETTINGS index_granularity = 8192;
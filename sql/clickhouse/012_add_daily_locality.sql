@@ -0,0 +1,51 @@
+-- Regions are grouped by the stable locality_id: 3-character region codes
+-- collide. Aggregated rows from before this migration have locality_id 0.
+ALTER TABLE repeater_reports_daily
+    ADD COLUMN IF NOT EXISTS locality_id SimpleAggregateFunction(anyLast, UInt32) CODEC(ZSTD(1)) AFTER country_code;
+
+ALTER TABLE dead_zones_daily
+    ADD COLUMN IF NOT EXISTS locality_id SimpleAggregateFunction(anyLast, UInt32) CODEC(ZSTD(1)) AFTER country_code;
+
+ALTER TABLE repeater_reports_daily_mv MODIFY QUERY
+SELECT
+    toDate(timestamp) AS day,
+    repeater_pubkey,
+    geohash,
+    radio_preset,
+    radio_freq,
+    radio_bw,
+    radio_sf,
+    radio_cr,
+    radio_tx,
+    anyLast(repeater_name) AS repeater_name,
+    anyLast(toString(region_code)) AS region_code,
+    anyLast(toString(district_code)) AS district_code,
+    anyLast(toString(country_code)) AS country_code,
+    anyLast(locality_id) AS locality_id,
+    count() AS reports,
+    sum(toInt64(rssi)) AS rssi_sum,
+    min(rssi) AS rssi_min,
+    max(rssi) AS rssi_max,
+    sum(toFloat64(snr)) AS snr_sum,
+    countIf(latitude IS NOT NULL AND longitude IS NOT NULL) AS located,
+    sum(ifNull(latitude, 0)) AS latitude_sum,
+    sum(ifNull(longitude, 0)) AS longitude_sum,
+    uniqState(toString(reporter_pubkey)) AS reporters,
+    max(timestamp) AS last_seen
+FROM repeater_reports
+GROUP BY day, repeater_pubkey, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx;
+
+ALTER TABLE dead_zones_daily_mv MODIFY QUERY
+SELECT
+    toDate(timestamp) AS day,
+    geohash,
+    radio_preset,
+    anyLast(toString(region_code)) AS region_code,
+    anyLast(toString(district_code)) AS district_code,
+    anyLast(toString(country_code)) AS country_code,
+    anyLast(locality_id) AS locality_id,
+    count() AS scans,
+    uniqState(toString(reporter_pubkey)) AS reporters,
+    max(timestamp) AS last_seen
+FROM dead_zones
+GROUP BY day, geohash, radio_preset;
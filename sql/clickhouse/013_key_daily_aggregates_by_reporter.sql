@@ -0,0 +1,131 @@
+-- The daily aggregates are kept after the raw rows expire, so they must not
+-- hold precise positions and must be erasable per reporter: drop the position
+-- sums and add the reporter to the key.
+ALTER TABLE repeater_reports_daily
+    ADD COLUMN IF NOT EXISTS reporter_pubkey FixedString(64) CODEC(ZSTD(1)) AFTER radio_tx,
+    MODIFY ORDER BY (repeater_pubkey, day, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, reporter_pubkey);
+
+ALTER TABLE dead_zones_daily
+    ADD COLUMN IF NOT EXISTS reporter_pubkey FixedString(64) CODEC(ZSTD(1)) AFTER radio_preset,
+    MODIFY ORDER BY (day, geohash, radio_preset, reporter_pubkey);
+
+ALTER TABLE repeater_reports_daily_mv MODIFY QUERY
+SELECT
+    toDate(timestamp) AS day,
+    repeater_pubkey,
+    geohash,
+    radio_preset,
+    radio_freq,
+    radio_bw,
+    radio_sf,
+    radio_cr,
+    radio_tx,
+    reporter_pubkey,
+    anyLast(repeater_name) AS repeater_name,
+    anyLast(toString(region_code)) AS region_code,
+    anyLast(toString(district_code)) AS district_code,
+    anyLast(toString(country_code)) AS country_code,
+    anyLast(locality_id) AS locality_id,
+    count() AS reports,
+    sum(toInt64(rssi)) AS rssi_sum,
+    min(rssi) AS rssi_min,
+    max(rssi) AS rssi_max,
+    sum(toFloat64(snr)) AS snr_sum,
+    uniqState(toString(reporter_pubkey)) AS reporters,
+    max(timestamp) AS last_seen
+FROM repeater_reports
+GROUP BY day, repeater_pubkey, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, reporter_pubkey;
+
+ALTER TABLE dead_zones_daily_mv MODIFY QUERY
+SELECT
+    toDate(timestamp) AS day,
+    geohash,
+    radio_preset,
+    reporter_pubkey,
+    anyLast(toString(region_code)) AS region_code,
+    anyLast(toString(district_code)) AS district_code,
+    anyLast(toString(country_code)) AS country_code,
+    anyLast(locality_id) AS locality_id,
+    count() AS scans,
+    uniqState(toString(reporter_pubkey)) AS reporters,
+    max(timestamp) AS last_seen
+FROM dead_zones
+GROUP BY day, geohash, radio_preset, reporter_pubkey;
+
+ALTER TABLE repeater_reports_daily
+    DROP COLUMN IF EXISTS located,
+    DROP COLUMN IF EXISTS latitude_sum,
+    DROP COLUMN IF EXISTS longitude_sum;
+
+-- Rebuild the rows aggregated without a reporter for the days whose raw rows
+-- are all still stored. Older rows cannot be attributed and stay as they are.
+ALTER TABLE repeater_reports_daily
+    DELETE WHERE empty(reporter_pubkey)
+        AND day > (SELECT toDate(minOrNull(timestamp)) FROM repeater_reports);
+
+INSERT INTO repeater_reports_daily (
+    day, repeater_pubkey, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, reporter_pubkey,
+    repeater_name, region_code, district_code, country_code, locality_id,
+    reports, rssi_sum, rssi_min, rssi_max, snr_sum, reporters, last_seen
+)
+SELECT
+    toDate(timestamp) AS day,
+    repeater_pubkey,
+    geohash,
+    radio_preset,
+    radio_freq,
+    radio_bw,
+    radio_sf,
+    radio_cr,
+    radio_tx,
+    reporter_pubkey,
+    anyLast(repeater_name),
+    anyLast(toString(region_code)),
+    anyLast(toString(district_code)),
+    anyLast(toString(country_code)),
+    anyLast(locality_id),
+    count(),
+    sum(toInt64(rssi)),
+    min(rssi),
+    max(rssi),
+    sum(toFloat64(snr)),
+    uniqState(toString(reporter_pubkey)),
+    max(timestamp)
+FROM repeater_reports
+WHERE toDate(timestamp) > (SELECT toDate(minOrNull(timestamp)) FROM repeater_reports)
+    AND ingested_at < (
+        SELECT metadata_modification_time
+        FROM system.tables
+        WHERE database = currentDatabase() AND name = 'repeater_reports_daily_mv'
+    )
+GROUP BY day, repeater_pubkey, geohash, radio_preset, radio_freq, radio_bw, radio_sf, radio_cr, radio_tx, reporter_pubkey;
+
+ALTER TABLE dead_zones_daily
+    DELETE WHERE empty(reporter_pubkey)
+        AND day > (SELECT toDate(minOrNull(timestamp)) FROM dead_zones);
+
+INSERT INTO dead_zones_daily (
+    day, geohash, radio_preset, reporter_pubkey,
+    region_code, district_code, country_code, locality_id,
+    scans, reporters, last_seen
+)
+SELECT
+    toDate(timestamp) AS day,
+    geohash,
+    radio_preset,
+    reporter_pubkey,
+    anyLast(toString(region_code)),
+    anyLast(toString(district_code)),
+    anyLast(toString(country_code)),
+    anyLast(locality_id),
+    count(),
+    uniqState(toString(reporter_pubkey)),
+    max(timestamp)
+FROM dead_zones
+WHERE toDate(timestamp) > (SELECT toDate(minOrNull(timestamp)) FROM dead_zones)
+    AND ingested_at < (
+        SELECT metadata_modification_time
+        FROM system.tables
+        WHERE database = currentDatabase() AND name = 'dead_zones_daily_mv'
+    )
+GROUP BY day, geohash, radio_preset, reporter_pubkey;
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultStatsWindow    = 30 * 24 * time.Hour
+	defaultStatsPrecision = 6
+	defaultStatsLimit     = 100
+)
+
+// Region codes nest: a region (nearest locality) is within a district
+// (admin1 subdivision), which is within a country. Regions are grouped by
+// locality_id, as 3-character region codes collide.
+var statsGroupColumns = map[string][]string{
+	"country":  {"country_code"},
+	"district": {"country_code", "district_code"},
+	"region":   {"country_code", "district_code", "locality_id"},
+}
+
+var statsSortColumns = map[string]string{
+	"repeaters":       "active_repeaters",
+	"reports":         "reports",
+	"reporters":       "reporters",
+	"covered_cells":   "covered_cells",
+	"dead_zone_cells": "dead_zone_cells",
+}
+
+type RegionStatsQuery struct {
+	GroupBy   string `form:"group_by" validate:"omitempty,oneof=country district region"`
+	Country   string `form:"country" validate:"omitempty,len=2,alpha"`
+	Preset    string `form:"preset" validate:"omitempty,radio_preset"`
+	From      string `form:"from" validate:"omitempty,timestamp"`
+	To        string `form:"to" validate:"omitempty,timestamp"`
+	Precision int    `form:"precision" validate:"omitempty,min=4,max=8"`
+	Sort      string `form:"sort" validate:"omitempty,oneof=repeaters reports reporters covered_cells dead_zone_cells"`
+	Limit     int    `form:"limit" validate:"omitempty,min=1,max=1000"`
+}
+
+type RegionStats struct {
+	CountryCode     string `json:"countryCode"`
+	DistrictCode    string `json:"districtCode,omitempty"`
+	LocalityID      uint32 `json:"localityId,omitempty"`
+	RegionCode      string `json:"regionCode,omitempty"`
+	ActiveRepeaters uint64 `json:"activeRepeaters"`
+	Reports         uint64 `json:"reports"`
+	Reporters       uint64 `json:"reporters"`
+	CoveredCells    uint64 `json:"coveredCells"`
+	DeadZoneCells   uint64 `json:"deadZoneCells"`
+}
+
+type RegionStatsResponse struct {
+	GroupBy   string        `json:"groupBy"`
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Precision int           `json:"precision"`
+	Regions   []RegionStats `json:"regions"`
+}
+
+func handleRegionStats(c *gin.Context) {
+	var query RegionStatsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	from, to, err := statsWindow(query.From, query.To, time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := RegionStatsResponse{
+		GroupBy:   query.GroupBy,
+		From:      from,
+		To:        to,
+		Precision: intValueOr(query.Precision, defaultStatsPrecision),
+	}
+	if response.GroupBy == "" {
+		response.GroupBy = "region"
+	}
+	sort := query.Sort
+	if sort == "" {
+		sort = "repeaters"
+	}
+
+	response.Regions, err = getRegionStats(response.GroupBy, strings.ToUpper(query.Country), query.Preset, from, to,
+		response.Precision, sort, intValueOr(query.Limit, defaultStatsLimit))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading region stats", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load region stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// statsWindow resolves the optional from and to parameters, defaulting to
+// the defaultStatsWindow before to, and to now.
+func statsWindow(fromParam, toParam string, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	if toParam != "" {
+		t, err := parseTimestamp(toParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultStatsWindow)
+	if fromParam != "" {
+		t, err := parseTimestamp(fromParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// getRegionStats counts, per region, the repeaters heard and the reports,
+// reporters and geohash cells of the given precision in the window. A cell
+// is covered when any report falls in it and a dead-zone cell when it only
+// has dead-zone scans. Days before the retention cutoff are read from the
+// daily aggregates, in whole days; reporters are counted approximately.
+func getRegionStats(groupBy, country, preset string, from, to time.Time, precision int, sort string, limit int) ([]RegionStats, error) {
+	ctx := context.Background()
+
+	columns := statsGroupColumns[groupBy]
+	keys := strings.Join(columns, ", ")
+
+	cutoff := rawDataCutoff(time.Now())
+	rawFrom, dailyTo := from, to
+	if rawFrom.Before(cutoff) {
+		rawFrom = cutoff
+	}
+	if dailyTo.After(cutoff) {
+		dailyTo = cutoff
+	}
+
+	rawWhere := "timestamp >= ? AND timestamp < ?"
+	dailyWhere := "day >= toDate(?) AND day < toDate(?)"
+	rawArgs := []any{precision, rawFrom, to}
+	dailyArgs := []any{precision, from, dailyTo}
+	if country != "" {
+		rawWhere += " AND country_code = ?"
+		dailyWhere += " AND country_code = ?"
+		rawArgs = append(rawArgs, country)
+		dailyArgs = append(dailyArgs, country)
+	}
+	if preset != "" {
+		rawWhere += " AND radio_preset = ?"
+		dailyWhere += " AND radio_preset = ?"
+		rawArgs = append(rawArgs, preset)
+		dailyArgs = append(dailyArgs, preset)
+	}
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT
+			%[1]s,
+			any(cell_region_code) AS region_code,
+			uniqExactMerge(repeaters) AS active_repeaters,
+			sum(cell_reports) AS reports,
+			uniqMerge(cell_reporters) AS reporters,
+			countIf(cell_reports > 0) AS covered_cells,
+			countIf(cell_reports = 0) AS dead_zone_cells
+		FROM (
+			SELECT
+				%[1]s,
+				cell,
+				any(region) AS cell_region_code,
+				sum(reports) AS cell_reports,
+				uniqExactStateIf(repeater, repeater != '') AS repeaters,
+				uniqMergeState(reporters) AS cell_reporters
+			FROM (
+				SELECT %[1]s, substring(geohash, 1, ?) AS cell, any(toString(region_code)) AS region, count() AS reports,
+					toString(repeater_pubkey) AS repeater, uniqState(toString(reporter_pubkey)) AS reporters
+				FROM repeater_reports
+				WHERE %[2]s
+				GROUP BY %[1]s, cell, repeater_pubkey
+				UNION ALL
+				SELECT %[1]s, substring(geohash, 1, ?) AS cell, any(region_code), sum(reports),
+					toString(repeater_pubkey), uniqMergeState(reporters)
+				FROM repeater_reports_daily
+				WHERE %[3]s
+				GROUP BY %[1]s, cell, repeater_pubkey
+				UNION ALL
+				SELECT %[1]s, substring(geohash, 1, ?) AS cell, any(toString(region_code)), toUInt64(0),
+					'', uniqState(toString(reporter_pubkey))
+				FROM dead_zones
+				WHERE %[2]s
+				GROUP BY %[1]s, cell
+				UNION ALL
+				SELECT %[1]s, substring(geohash, 1, ?) AS cell, any(region_code), toUInt64(0),
+					'', uniqMergeState(reporters)
+				FROM dead_zones_daily
+				WHERE %[3]s
+				GROUP BY %[1]s, cell
+			)
+			GROUP BY %[1]s, cell
+		)
+		GROUP BY %[1]s
+		ORDER BY %[4]s DESC, %[1]s
+		LIMIT ?
+	`, keys, rawWhere, dailyWhere, statsSortColumns[sort]),
+		slices.Concat(rawArgs, dailyArgs, rawArgs, dailyArgs, []any{limit})...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query region stats: %w", err)
+	}
+	defer rows.Close()
+
+	regions := make([]RegionStats, 0)
+	for rows.Next() {
+		var r RegionStats
+		var regionCode string
+		dest := []any{&r.CountryCode, &r.DistrictCode, &r.LocalityID}[:len(columns):len(columns)]
+		dest = append(dest, &regionCode, &r.ActiveRepeaters, &r.Reports, &r.Reporters, &r.CoveredCells, &r.DeadZoneCells)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan region stats: %w", err)
+		}
+		if groupBy == "region" {
+			r.RegionCode = regionCode
+		}
+
+		r.CountryCode = strings.TrimRight(r.CountryCode, "\x00")
+		r.DistrictCode = strings.TrimRight(r.DistrictCode, "\x00")
+		r.RegionCode = strings.TrimRight(r.RegionCode, "\x00")
+		regions = append(regions, r)
+	}
+
+	return regions, rows.Err()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans go to the global tracer provider, a no-op unless startTracing
+// registers the SDK.
+var tracer = otel.Tracer("meshcore-map-api")
+
+func init() {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// startTracing registers a tracer provider exporting spans in batches to the
+// configured OTLP/HTTP endpoint and returns the function flushing and
+// stopping it. Without an endpoint spans are discarded.
+func startTracing(ctx context.Context) (func(context.Context) error, error) {
+	c := cfg.Tracing
+	if c.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(c.Endpoint, "/")+"/v1/traces"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override these.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "meshcore-map-api"),
+			attribute.String("service.version", commit),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	slog.Info("Exporting traces", "endpoint", c.Endpoint, "sample_ratio", c.SampleRatio)
+	return provider.Shutdown, nil
+}
+
+// traceRequests starts a server span for every request, continuing the trace
+// of an incoming traceparent header, and returns the trace ID in the
+// X-Trace-Id header.
+func traceRequests(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	route := cmp.Or(c.FullPath(), "unmatched")
+	ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+		))
+	defer span.End()
+
+	// Without an exporter or an incoming trace the span has no IDs. A random trace
+	// ID still ties the response to its log lines.
+	if !span.SpanContext().IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, newSpanContext())
+	}
+	traceID := trace.SpanContextFromContext(ctx).TraceID().String()
+	c.Set("traceID", traceID)
+	c.Header("X-Trace-Id", traceID)
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+func newSpanContext() trace.SpanContext {
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	rand.Read(traceID[:])
+	rand.Read(spanID[:])
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startInsert starts the span of an insert into table.
+func startInsert(ctx context.Context, table string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "INSERT "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "clickhouse"),
+			attribute.String("db.collection.name", table),
+		))
+}
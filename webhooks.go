@@ -0,0 +1,833 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"meshcore-map-api/internal/geodesy"
+)
+
+const (
+	EventRepeaterNew    = "repeater.new"
+	EventRepeaterSilent = "repeater.silent"
+	EventRepeaterMoved  = "repeater.moved"
+	EventDeadZoneNew    = "dead_zone.new"
+	// EventPing is only sent by POST /admin/webhooks/:id/ping.
+	EventPing = "ping"
+)
+
+const (
+	webhookWorkers   = 4
+	webhookQueueSize = 1000
+	deliveriesLimit  = 100
+)
+
+type Webhook struct {
+	ID           uuid.UUID `json:"id"`
+	URL          string    `json:"url"`
+	Secret       string    `json:"-"`
+	Events       []string  `json:"events"`
+	Regions      []string  `json:"regions,omitempty"`
+	Repeaters    []string  `json:"repeaters,omitempty"`
+	SilenceHours int       `json:"silenceHours,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// CreatedWebhook is the only response carrying the secret.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookRequest struct {
+	URL          string   `json:"url" validate:"required,http_url,max=2048"`
+	Events       []string `json:"events" validate:"required,min=1,dive,oneof=repeater.new repeater.silent repeater.moved dead_zone.new"`
+	Regions      []string `json:"regions" validate:"omitempty,max=100,dive,min=2,max=10"`
+	Repeaters    []string `json:"repeaters" validate:"omitempty,max=1000,dive,len=64,hexadecimal"`
+	SilenceHours int      `json:"silenceHours" validate:"omitempty,min=1,max=720"`
+}
+
+// WebhookEvent is the body of every delivery.
+type WebhookEvent struct {
+	ID         uuid.UUID `json:"id"`
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Data       any       `json:"data"`
+}
+
+type WebhookRepeater struct {
+	PublicKey       string     `json:"publicKey"`
+	Name            string     `json:"name"`
+	Lat             *float64   `json:"lat,omitempty"`
+	Lon             *float64   `json:"lon,omitempty"`
+	CountryCode     string     `json:"countryCode,omitempty"`
+	SubdivisionCode string     `json:"subdivisionCode,omitempty"`
+	PreviousLat     *float64   `json:"previousLat,omitempty"`
+	PreviousLon     *float64   `json:"previousLon,omitempty"`
+	MovedM          float64    `json:"movedM,omitempty"`
+	LastHeard       *time.Time `json:"lastHeard,omitempty"`
+}
+
+// Like on GET /live, dead zones are placed at the centre of their stored
+// geohash cell.
+type WebhookDeadZone struct {
+	ReporterName    string  `json:"reporterName"`
+	Preset          string  `json:"preset,omitempty"`
+	Geohash         string  `json:"geohash"`
+	Lat             float64 `json:"lat"`
+	Lon             float64 `json:"lon"`
+	CountryCode     string  `json:"countryCode,omitempty"`
+	SubdivisionCode string  `json:"subdivisionCode,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID          uuid.UUID `json:"id"`
+	WebhookID   uuid.UUID `json:"webhookId"`
+	Event       string    `json:"event"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"durationMs"`
+	Delivered   bool      `json:"delivered"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+}
+
+// webhookFilter is what webhooks filter an event on.
+type webhookFilter struct {
+	countryCode     string
+	subdivisionCode string
+	repeater        string
+}
+
+func (w Webhook) matches(event string, f webhookFilter) bool {
+	if !slices.Contains(w.Events, event) {
+		return false
+	}
+	if len(w.Regions) > 0 && !slices.Contains(w.Regions, f.countryCode) && !slices.Contains(w.Regions, f.subdivisionCode) {
+		return false
+	}
+	// Dead zones aren't tied to a repeater.
+	if len(w.Repeaters) > 0 && f.repeater != "" && !slices.Contains(w.Repeaters, f.repeater) {
+		return false
+	}
+	return true
+}
+
+// webhookRegistry caches the registered webhooks. It is reloaded after every
+// change and with each silence check, to pick up changes made through other
+// instances.
+type webhookRegistry struct {
+	mu       sync.RWMutex
+	webhooks []Webhook
+}
+
+var webhooks = &webhookRegistry{}
+
+func (r *webhookRegistry) load(ctx context.Context) error {
+	list, err := getWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.webhooks = list
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *webhookRegistry) subscribed(events ...string) []Webhook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []Webhook
+	for _, w := range r.webhooks {
+		if slices.ContainsFunc(events, func(e string) bool { return slices.Contains(w.Events, e) }) {
+			list = append(list, w)
+		}
+	}
+	return list
+}
+
+type webhookNotification struct {
+	webhook Webhook
+	event   WebhookEvent
+}
+
+// webhookDispatcher delivers queued notifications, retrying failed ones with
+// exponential backoff, and records every attempt.
+type webhookDispatcher struct {
+	client *http.Client
+	queue  chan webhookNotification
+	record func(context.Context, WebhookDelivery) error
+	// draining is closed on shutdown, once no request can queue more.
+	draining chan struct{}
+}
+
+var dispatcher = &webhookDispatcher{
+	client:   &http.Client{},
+	queue:    make(chan webhookNotification, webhookQueueSize),
+	record:   saveWebhookDelivery,
+	draining: make(chan struct{}),
+}
+
+// notify queues event for every webhook subscribed to it whose filters match
+// f. It never waits: when the queue is full the notification is dropped.
+func notify(ctx context.Context, event string, f webhookFilter, data any) {
+	for _, w := range webhooks.subscribed(event) {
+		if w.matches(event, f) {
+			dispatcher.enqueue(ctx, w, event, data)
+		}
+	}
+}
+
+// isNewDeadZoneCell reports whether dead_zone.new should fire for a dead zone
+// stored at hash: a webhook subscribes to it and no dead zone or report was
+// stored before in its cell at webhooks.dead_zone_precision.
+func isNewDeadZoneCell(ctx context.Context, hash string) bool {
+	if len(webhooks.subscribed(EventDeadZoneNew)) == 0 {
+		return false
+	}
+
+	cell := hash[:min(len(hash), cfg.Webhooks.DeadZonePrecision)]
+	seen, err := cellHasData(ctx, cell)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking for earlier data in the dead zone cell", "error", err)
+		return false
+	}
+	return !seen
+}
+
+// cellHasData reports whether a dead zone or report is stored in the geohash
+// cell. Tests replace it.
+var cellHasData = func(ctx context.Context, cell string) (bool, error) {
+	var seen bool
+	err := db.QueryRow(ctx, `
+		SELECT count() > 0
+		FROM (
+			(SELECT 1 FROM dead_zones WHERE startsWith(geohash, ?) LIMIT 1)
+			UNION ALL
+			(SELECT 1 FROM repeater_reports WHERE startsWith(geohash, ?) LIMIT 1)
+		)
+	`, cell, cell).Scan(&seen)
+	if err != nil {
+		return false, fmt.Errorf("failed to query cell %s: %w", cell, err)
+	}
+	return seen, nil
+}
+
+func (d *webhookDispatcher) enqueue(ctx context.Context, w Webhook, event string, data any) {
+	n := webhookNotification{
+		webhook: w,
+		event:   WebhookEvent{ID: uuid.New(), Event: event, OccurredAt: time.Now().UTC(), Data: data},
+	}
+	select {
+	case d.queue <- n:
+	default:
+		webhookDropped.Inc()
+		slog.WarnContext(ctx, "Webhook queue full, notification dropped", "webhook_id", w.ID, "event", event)
+	}
+}
+
+// run delivers notifications until the dispatcher drains, then delivers the
+// ones still queued and returns. Deliveries and retries still pending when
+// ctx is done are abandoned.
+func (d *webhookDispatcher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-d.queue:
+			d.deliver(ctx, n)
+		case <-d.draining:
+			for ctx.Err() == nil {
+				select {
+				case n := <-d.queue:
+					d.deliver(ctx, n)
+				default:
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+func (d *webhookDispatcher) deliver(ctx context.Context, n webhookNotification) {
+	body, err := json.Marshal(n.event)
+	if err != nil {
+		slog.Error("Error encoding webhook event", "event", n.event.Event, "error", err)
+		return
+	}
+
+	backoff := time.Duration(cfg.Webhooks.RetryBackoff)
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		status, err := d.post(ctx, n.webhook, n.event, body)
+
+		delivery := WebhookDelivery{
+			ID:          n.event.ID,
+			WebhookID:   n.webhook.ID,
+			Event:       n.event.Event,
+			Attempt:     attempt,
+			StatusCode:  status,
+			DurationMs:  time.Since(start).Milliseconds(),
+			Delivered:   err == nil,
+			AttemptedAt: start.UTC(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if recordErr := d.record(context.WithoutCancel(ctx), delivery); recordErr != nil {
+			slog.Error("Error recording webhook delivery", "webhook_id", n.webhook.ID, "error", recordErr)
+		}
+
+		attrs := []any{"webhook_id", n.webhook.ID, "delivery_id", n.event.ID, "event", n.event.Event,
+			"attempt", attempt, "status", status, "duration_ms", delivery.DurationMs}
+		if err == nil {
+			webhookAttempts.WithLabelValues("delivered").Inc()
+			slog.Info("Webhook delivered", attrs...)
+			return
+		}
+		webhookAttempts.WithLabelValues("failed").Inc()
+
+		if attempt >= cfg.Webhooks.MaxAttempts || !retryable(status) {
+			slog.Error("Webhook delivery failed", append(attrs, "error", err)...)
+			return
+		}
+		slog.Warn("Webhook delivery failed, retrying", append(attrs, "error", err, "retry_in_ms", backoff.Milliseconds())...)
+
+		// Jitter keeps retries to one endpoint from arriving in bursts.
+		wait := backoff + mathrand.N(backoff/4+1)
+		select {
+		case <-ctx.Done():
+			slog.Warn("Webhook retry abandoned on shutdown", "webhook_id", n.webhook.ID, "delivery_id", n.event.ID)
+			return
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends one attempt and returns the response status, or 0 when none
+// was received.
+func (d *webhookDispatcher) post(ctx context.Context, w Webhook, event WebhookEvent, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Webhooks.Timeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "meshcore-map-api/"+cmp.Or(commit, "unknown"))
+	req.Header.Set("X-Webhook-Id", event.ID.String())
+	req.Header.Set("X-Webhook-Event", event.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhook(w.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// Leave out the URL, which may hold a token, e.g. for Discord.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return 0, urlErr.Err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether an attempt that got status, 0 for none, may
+// succeed later. Other client errors won't.
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// signWebhook is the X-Webhook-Signature of a delivery: the hex HMAC-SHA256,
+// keyed with the webhook secret, of "<X-Webhook-Timestamp>.<body>".
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// startWebhooks loads the webhooks and runs the silence check until ctx is
+// done, and the dispatcher until the returned function is called after the
+// server has shut down. The dispatcher then delivers what is queued, until
+// the context given to that function is done.
+func startWebhooks(ctx context.Context) (stop func(context.Context)) {
+	if err := webhooks.load(ctx); err != nil {
+		slog.Error("Error loading webhooks", "error", err)
+	}
+	// The workers outlive ctx, to deliver the notifications of the requests
+	// still in flight when the server shuts down.
+	deliverCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	for range webhookWorkers {
+		background.Go(func() { dispatcher.run(deliverCtx) })
+	}
+	if interval := time.Duration(cfg.Webhooks.CheckInterval); interval > 0 {
+		background.Go(func() { runSilenceChecks(ctx, interval) })
+	}
+
+	return func(shutdownCtx context.Context) {
+		context.AfterFunc(shutdownCtx, cancel)
+		close(dispatcher.draining)
+	}
+}
+
+// runSilenceChecks notifies repeater.silent once per repeater going silent:
+// each check looks for repeaters last heard exactly N hours before a time
+// since the previous check. Repeaters going silent while the server is
+// down aren't notified.
+func runSilenceChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	since := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := webhooks.load(ctx); err != nil {
+				slog.Error("Error loading webhooks", "error", err)
+			}
+			if err := checkSilentRepeaters(ctx, since, now); err != nil {
+				slog.Error("Error checking silent repeaters", "error", err)
+				continue
+			}
+			since = now
+		}
+	}
+}
+
+func checkSilentRepeaters(ctx context.Context, since, now time.Time) error {
+	byHours := make(map[int][]Webhook)
+	for _, w := range webhooks.subscribed(EventRepeaterSilent) {
+		byHours[w.SilenceHours] = append(byHours[w.SilenceHours], w)
+	}
+
+	for hours, list := range byHours {
+		silence := time.Duration(hours) * time.Hour
+		lastHeard, err := getRepeatersLastHeard(ctx, since.Add(-silence), now.Add(-silence))
+		if err != nil {
+			return err
+		}
+		if len(lastHeard) == 0 {
+			continue
+		}
+
+		pubkeys := make([]string, 0, len(lastHeard))
+		for pubkey := range lastHeard {
+			pubkeys = append(pubkeys, pubkey)
+		}
+		positions, err := getRepeaterPositions(ctx, pubkeys)
+		if err != nil {
+			return err
+		}
+
+		for pubkey, heard := range lastHeard {
+			data := WebhookRepeater{PublicKey: pubkey, LastHeard: &heard}
+			f := webhookFilter{repeater: pubkey}
+			if p, ok := positions[pubkey]; ok {
+				data.Name, data.Lat, data.Lon = p.name, p.lat, p.lon
+				f = repeaterFilter(ctx, &data)
+			}
+			for _, w := range list {
+				if w.matches(EventRepeaterSilent, f) {
+					dispatcher.enqueue(ctx, w, EventRepeaterSilent, data)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// repeaterFilter geocodes a repeater for region filters.
+func repeaterFilter(ctx context.Context, r *WebhookRepeater) webhookFilter {
+	f := webhookFilter{repeater: r.PublicKey}
+	if r.Lat != nil && r.Lon != nil {
+		location := locate(ctx, *r.Lat, *r.Lon)
+		r.CountryCode, r.SubdivisionCode = location.CountryCode, location.SubdivisionCode
+		f.countryCode, f.subdivisionCode = location.CountryCode, location.SubdivisionCode
+	}
+	return f
+}
+
+type repeaterPosition struct {
+	name     string
+	lat, lon *float64
+}
+
+// repeaterChanges returns the repeater.new and repeater.moved notifications
+// an upsert of repeaters will cause, given their stored positions.
+func repeaterChanges(repeaters []RepeaterData, stored map[string]repeaterPosition) []WebhookRepeater {
+	var changes []WebhookRepeater
+	seen := make(map[string]bool)
+	for _, r := range repeaters {
+		pubkey := strings.ToLower(r.PublicKey)
+		if seen[pubkey] {
+			continue
+		}
+		seen[pubkey] = true
+		change := WebhookRepeater{PublicKey: pubkey, Name: r.Name, Lat: &r.Lat, Lon: &r.Lon}
+
+		previous, ok := stored[pubkey]
+		if !ok {
+			changes = append(changes, change)
+			continue
+		}
+		if previous.lat == nil || previous.lon == nil {
+			continue
+		}
+		movedM := geodesy.Distance(*previous.lat, *previous.lon, r.Lat, r.Lon) * 1000
+		if movedM > cfg.Webhooks.MoveThresholdM {
+			change.PreviousLat, change.PreviousLon, change.MovedM = previous.lat, previous.lon, movedM
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// notifyRepeaterChanges notifies repeater.new and repeater.moved for an
+// upsert that is about to be stored, and returns a function to call once it
+// is. Without webhooks for them, stored positions aren't even looked up.
+func notifyRepeaterChanges(ctx context.Context, repeaters []RepeaterData) (func(), error) {
+	if len(webhooks.subscribed(EventRepeaterNew, EventRepeaterMoved)) == 0 {
+		return func() {}, nil
+	}
+
+	pubkeys := make([]string, 0, len(repeaters))
+	for _, r := range repeaters {
+		pubkeys = append(pubkeys, strings.ToLower(r.PublicKey))
+	}
+	stored, err := getRepeaterPositions(ctx, pubkeys)
+	if err != nil {
+		return nil, err
+	}
+	changes := repeaterChanges(repeaters, stored)
+
+	return func() {
+		for _, change := range changes {
+			event := EventRepeaterNew
+			if change.PreviousLat != nil {
+				event = EventRepeaterMoved
+			}
+			notify(ctx, event, repeaterFilter(ctx, &change), change)
+		}
+	}, nil
+}
+
+func getRepeaterPositions(ctx context.Context, pubkeys []string) (map[string]repeaterPosition, error) {
+	rows, err := db.Query(ctx, `
+		SELECT lower(toString(public_key)), name, lat, lon
+		FROM repeaters FINAL
+		WHERE lower(toString(public_key)) IN (?)
+	`, pubkeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query repeaters: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make(map[string]repeaterPosition)
+	for rows.Next() {
+		var pubkey string
+		var p repeaterPosition
+		if err := rows.Scan(&pubkey, &p.name, &p.lat, &p.lon); err != nil {
+			return nil, fmt.Errorf("failed to scan repeater: %w", err)
+		}
+		positions[pubkey] = p
+	}
+	return positions, rows.Err()
+}
+
+// getRepeatersLastHeard returns the repeaters last heard in (from, to].
+func getRepeatersLastHeard(ctx context.Context, from, to time.Time) (map[string]time.Time, error) {
+	rows, err := db.Query(ctx, `
+		SELECT lower(toString(repeater_pubkey)) AS pubkey, max(timestamp) AS last_heard
+		FROM repeater_reports
+		WHERE timestamp > ?
+		GROUP BY pubkey
+		HAVING last_heard <= ?
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query last heard repeaters: %w", err)
+	}
+	defer rows.Close()
+
+	lastHeard := make(map[string]time.Time)
+	for rows.Next() {
+		var pubkey string
+		var heard time.Time
+		if err := rows.Scan(&pubkey, &heard); err != nil {
+			return nil, fmt.Errorf("failed to scan last heard repeater: %w", err)
+		}
+		lastHeard[strings.TrimRight(pubkey, "\x00")] = heard
+	}
+	return lastHeard, rows.Err()
+}
+
+func getWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, url, secret, events, regions, repeaters, silence_hours, created_at, updated_at
+		FROM webhooks FINAL
+		WHERE NOT deleted
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Webhook
+	for rows.Next() {
+		var w Webhook
+		var hours uint16
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, &w.Events, &w.Regions, &w.Repeaters, &hours, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		w.SilenceHours = int(hours)
+		list = append(list, w)
+	}
+	return list, rows.Err()
+}
+
+func getWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	var w Webhook
+	var hours uint16
+	err := db.QueryRow(ctx, `
+		SELECT id, url, secret, events, regions, repeaters, silence_hours, created_at, updated_at
+		FROM webhooks FINAL
+		WHERE id = ? AND NOT deleted
+	`, id).Scan(&w.ID, &w.URL, &w.Secret, &w.Events, &w.Regions, &w.Repeaters, &hours, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	w.SilenceHours = int(hours)
+	return &w, nil
+}
+
+func saveWebhook(ctx context.Context, w *Webhook, deleted bool) error {
+	err := db.Exec(ctx, `
+		INSERT INTO webhooks (id, url, secret, events, regions, repeaters, silence_hours, deleted, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, w.ID, w.URL, w.Secret, w.Events, w.Regions, w.Repeaters, uint16(w.SilenceHours), deleted, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return nil
+}
+
+func saveWebhookDelivery(ctx context.Context, d WebhookDelivery) error {
+	err := db.Exec(ctx, `
+		INSERT INTO webhook_deliveries (id, webhook_id, event, attempt, status_code, error, duration_ms, delivered, attempted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, d.ID, d.WebhookID, d.Event, uint8(d.Attempt), uint16(d.StatusCode), d.Error, uint32(d.DurationMs), d.Delivered, d.AttemptedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func getWebhookDeliveries(ctx context.Context, id uuid.UUID) ([]WebhookDelivery, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, webhook_id, event, attempt, status_code, error, duration_ms, delivered, attempted_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY attempted_at DESC
+		LIMIT ?
+	`, id, deliveriesLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var attempt uint8
+		var status uint16
+		var duration uint32
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &attempt, &status, &d.Error, &duration, &d.Delivered, &d.AttemptedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Attempt, d.StatusCode, d.DurationMs = int(attempt), int(status), int64(duration)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func handleListWebhooks(c *gin.Context) {
+	list, err := getWebhooks(c.Request.Context())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading webhooks", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load webhooks"})
+		return
+	}
+	if list == nil {
+		list = []Webhook{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func handleCreateWebhook(c *gin.Context) {
+	var request WebhookRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON: " + err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if slices.Contains(request.Events, EventRepeaterSilent) && request.SilenceHours == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "silenceHours is required for " + EventRepeaterSilent})
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error generating webhook secret", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create webhook"})
+		return
+	}
+
+	now := time.Now().UTC()
+	w := Webhook{
+		ID:           uuid.New(),
+		URL:          request.URL,
+		Secret:       hex.EncodeToString(secret),
+		Events:       slices.Compact(slices.Sorted(slices.Values(request.Events))),
+		Regions:      upper(request.Regions),
+		Repeaters:    lower(request.Repeaters),
+		SilenceHours: request.SilenceHours,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := saveWebhook(c.Request.Context(), &w, false); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create webhook"})
+		return
+	}
+	reloadWebhooks(c.Request.Context())
+
+	slog.InfoContext(c.Request.Context(), "Webhook created", "webhook_id", w.ID, "events", w.Events)
+	c.JSON(http.StatusCreated, CreatedWebhook{Webhook: w, Secret: w.Secret})
+}
+
+func handleDeleteWebhook(c *gin.Context) {
+	w, ok := loadWebhookParam(c)
+	if !ok {
+		return
+	}
+
+	w.UpdatedAt = time.Now().UTC()
+	if err := saveWebhook(c.Request.Context(), w, true); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error deleting webhook", "webhook_id", w.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete webhook"})
+		return
+	}
+	reloadWebhooks(c.Request.Context())
+
+	slog.InfoContext(c.Request.Context(), "Webhook deleted", "webhook_id", w.ID)
+	c.Status(http.StatusNoContent)
+}
+
+func handleWebhookDeliveries(c *gin.Context) {
+	w, ok := loadWebhookParam(c)
+	if !ok {
+		return
+	}
+
+	deliveries, err := getWebhookDeliveries(c.Request.Context(), w.ID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading webhook deliveries", "webhook_id", w.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load deliveries"})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// handlePingWebhook queues a ping event, to test an endpoint.
+func handlePingWebhook(c *gin.Context) {
+	w, ok := loadWebhookParam(c)
+	if !ok {
+		return
+	}
+
+	dispatcher.enqueue(c.Request.Context(), *w, EventPing, gin.H{"webhookId": w.ID})
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued"})
+}
+
+func loadWebhookParam(c *gin.Context) (*Webhook, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid webhook ID"})
+		return nil, false
+	}
+
+	w, err := getWebhook(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Webhook not found"})
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading webhook", "webhook_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load webhook"})
+		return nil, false
+	}
+	return w, true
+}
+
+func reloadWebhooks(ctx context.Context) {
+	if err := webhooks.load(ctx); err != nil {
+		slog.ErrorContext(ctx, "Error reloading webhooks", "error", err)
+	}
+}
+
+func upper(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToUpper(v)
+	}
+	return out
+}
+
+func lower(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(v)
+	}
+	return out
+}